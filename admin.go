@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Restore tuning
+const (
+	restoreBatchSize    = 500
+	restoreMaxLineBytes = 1 << 20
+	snapshotFlushRows   = 500
+)
+
+// requireAdmin protects admin routes with the X-Admin-Token header. Admin
+// routes are disabled entirely while ADMIN_TOKEN is unset.
+func requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusForbidden, CodeForbidden, "Admin endpoints are disabled; set ADMIN_TOKEN to enable them")
+			return
+		}
+
+		provided := r.Header.Get("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			w.Header().Set("Content-Type", "application/json")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Missing or invalid admin token")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SnapshotTodos handles GET /admin/snapshot. Every document is streamed as
+// one line of relaxed Extended JSON, which keeps ObjectIDs and dates intact
+// for RestoreTodos.
+func (h *TodoHandler) SnapshotTodos(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	cursor, err := h.collection.Find(ctx, bson.M{}, options.Find().SetBatchSize(exportBatchSize))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		writeDatabaseError(ctx, w, err, "Failed to read todos")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="todos-snapshot.ndjson"`)
+
+	flusher, _ := w.(http.Flusher)
+	writer := bufio.NewWriter(w)
+	rows := 0
+	for cursor.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cursor.Current, false, false)
+		if err != nil {
+			requestLogger(ctx).Error("Snapshot: failed to encode document", "error", err)
+			return
+		}
+		writer.Write(line)
+		writer.WriteByte('\n')
+
+		rows++
+		if rows%snapshotFlushRows == 0 {
+			if err := writer.Flush(); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		requestLogger(ctx).Error("Snapshot: cursor stopped early", "documents", rows, "error", err)
+	}
+	writer.Flush()
+}
+
+// RestoreTodos handles POST /admin/restore. It loads a snapshot produced by
+// SnapshotTodos. The whole snapshot is parsed before anything is written.
+// Documents whose _id already exists are skipped. With ?wipe=true the
+// collection is emptied first, which additionally requires ?confirm=wipe.
+func (h *TodoHandler) RestoreTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx := r.Context()
+
+	wipe, err := parseBoolParam(r, "wipe")
+	if err != nil {
+		writeInvalidBool(w, "wipe")
+		return
+	}
+	if wipe && r.URL.Query().Get("confirm") != "wipe" {
+		writeError(w, http.StatusBadRequest, CodeConfirmationRequired, "Restoring with wipe=true requires confirm=wipe")
+		return
+	}
+
+	// Read the whole snapshot before writing anything, so a bad line can
+	// never leave the collection wiped or half restored
+	var docs []interface{}
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), restoreMaxLineBytes)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var doc bson.D
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), false, &doc); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": "Invalid snapshot document",
+				"code":  CodeInvalidSnapshot,
+				"line":  line,
+			})
+			return
+		}
+		docs = append(docs, doc)
+	}
+	if err := scanner.Err(); err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidSnapshot, "Failed to read snapshot")
+		return
+	}
+
+	var wiped int64
+	if wipe {
+		result, err := h.collection.DeleteMany(ctx, bson.M{})
+		h.invalidateAll()
+		if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to wipe todos")
+			return
+		}
+		wiped = result.DeletedCount
+	}
+
+	var restored, skipped int64
+	for start := 0; start < len(docs); start += restoreBatchSize {
+		end := start + restoreBatchSize
+		if end > len(docs) {
+			end = len(docs)
+		}
+		var inserted, duplicates int64
+		inserted, duplicates, err = h.insertSnapshotBatch(ctx, docs[start:end])
+		restored += inserted
+		skipped += duplicates
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":    "Restore stopped before completing",
+			"code":     CodeRestoreFailed,
+			"restored": restored,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int64{
+		"wiped":    wiped,
+		"restored": restored,
+		"skipped":  skipped,
+	})
+}
+
+// insertSnapshotBatch inserts documents unordered, counting duplicate _ids
+// (and titles) as skipped rather than failing the whole batch
+func (h *TodoHandler) insertSnapshotBatch(ctx context.Context, docs []interface{}) (inserted, skipped int64, err error) {
+	result, err := h.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if result != nil {
+		inserted = int64(len(result.InsertedIDs))
+	}
+	if err == nil {
+		return inserted, 0, nil
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return inserted, 0, err
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != 11000 {
+			return inserted, skipped, err
+		}
+		skipped++
+	}
+	return int64(len(docs)) - skipped, skipped, nil
+}
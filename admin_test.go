@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSnapshotRestoreRoundTrip(t *testing.T) {
+	var inserted []bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName != "insert" {
+				return
+			}
+			values, _ := evt.Command.Lookup("documents").Array().Values()
+			for _, value := range values {
+				inserted = append(inserted, value.Document())
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("round trip", func(mt *mtest.T) {
+		createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		docs := []bson.D{
+			{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Buy milk"}, {Key: "created_at", Value: createdAt}},
+			{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Walk the dog"}, {Key: "metadata", Value: bson.D{{Key: "where", Value: "park"}}}},
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, docs...),
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: len(docs)}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		snapshot := httptest.NewRecorder()
+		h.SnapshotTodos(snapshot, httptest.NewRequest(http.MethodGet, "/api/v1/admin/snapshot", nil))
+		if snapshot.Code != http.StatusOK {
+			t.Fatalf("snapshot: status = %d, want 200", snapshot.Code)
+		}
+
+		restore := httptest.NewRecorder()
+		h.RestoreTodos(restore, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore", bytes.NewReader(snapshot.Body.Bytes())))
+		if restore.Code != http.StatusOK {
+			t.Fatalf("restore: status = %d, want 200: %s", restore.Code, restore.Body)
+		}
+		var counts map[string]int64
+		if err := json.Unmarshal(restore.Body.Bytes(), &counts); err != nil {
+			t.Fatal(err)
+		}
+		if counts["restored"] != int64(len(docs)) || counts["skipped"] != 0 || counts["wiped"] != 0 {
+			t.Errorf("counts = %v, want %d restored", counts, len(docs))
+		}
+
+		// The restored documents are identical to the ones snapshotted
+		if len(inserted) != len(docs) {
+			t.Fatalf("inserted %d documents, want %d", len(inserted), len(docs))
+		}
+		for i, doc := range docs {
+			want, err := bson.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(inserted[i], want) {
+				t.Errorf("document %d: inserted %s, want %s", i, inserted[i], bson.Raw(want))
+			}
+		}
+	})
+
+	mt.Run("round trip with wipe", func(mt *mtest.T) {
+		inserted = nil
+		doc := bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Buy milk"}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, doc),
+			// The wipe removes the three todos now in the collection
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 3}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		snapshot := httptest.NewRecorder()
+		h.SnapshotTodos(snapshot, httptest.NewRequest(http.MethodGet, "/api/v1/admin/snapshot", nil))
+
+		restore := httptest.NewRecorder()
+		h.RestoreTodos(restore, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore?wipe=true&confirm=wipe", bytes.NewReader(snapshot.Body.Bytes())))
+		var counts map[string]int64
+		if err := json.Unmarshal(restore.Body.Bytes(), &counts); err != nil {
+			t.Fatal(err)
+		}
+		if restore.Code != http.StatusOK || counts["wiped"] != 3 || counts["restored"] != 1 {
+			t.Errorf("got %d %v, want 3 wiped and 1 restored", restore.Code, counts)
+		}
+		want, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inserted) != 1 || !bytes.Equal(inserted[0], want) {
+			t.Errorf("inserted %v, want %s", inserted, bson.Raw(want))
+		}
+	})
+}
+
+func TestRestoreTodosWipeRequiresConfirmation(t *testing.T) {
+	h := NewTodoHandler(nil)
+
+	rec := httptest.NewRecorder()
+	h.RestoreTodos(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore?wipe=true", strings.NewReader("")))
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeConfirmationRequired) {
+		t.Errorf("got %d %s, want 400 CONFIRMATION_REQUIRED", rec.Code, rec.Body)
+	}
+}
+
+func TestRestoreTodosInvalidSnapshotWipesNothing(t *testing.T) {
+	var commands []string
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			commands = append(commands, evt.CommandName)
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("bad last line", func(mt *mtest.T) {
+		h := NewTodoHandler(mt.Coll)
+		body := `{"_id":{"$oid":"6650b2f4e4b0a1a2b3c4d5e6"},"title":"Buy milk"}` + "\n" + `{"title":`
+
+		rec := httptest.NewRecorder()
+		h.RestoreTodos(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore?wipe=true&confirm=wipe", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeInvalidSnapshot) || !strings.Contains(rec.Body.String(), `"line":2`) {
+			t.Errorf("got %d %s, want 400 INVALID_SNAPSHOT on line 2", rec.Code, rec.Body)
+		}
+		if len(commands) != 0 {
+			t.Errorf("sent %v, want nothing wiped or inserted", commands)
+		}
+	})
+}
+
+func TestRestoreTodosInsertFailure(t *testing.T) {
+	var inserts int
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName == "insert" {
+				inserts++
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("first batch fails", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		h := NewTodoHandler(mt.Coll)
+
+		// More than one batch, so the failure is not in the last one
+		var body strings.Builder
+		for i := 0; i <= restoreBatchSize; i++ {
+			doc, err := bson.MarshalExtJSON(bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Todo"}}, false, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body.Write(doc)
+			body.WriteString("\n")
+		}
+
+		rec := httptest.NewRecorder()
+		h.RestoreTodos(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/restore", strings.NewReader(body.String())))
+		if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), CodeRestoreFailed) {
+			t.Errorf("got %d %s, want 500 RESTORE_FAILED", rec.Code, rec.Body)
+		}
+		if inserts != 1 {
+			t.Errorf("sent %d inserts, want the restore to stop after the failed one", inserts)
+		}
+	})
+}
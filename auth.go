@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// JWT validation failures
+var (
+	errTokenInvalid = errors.New("invalid token")
+	errTokenExpired = errors.New("token has expired")
+)
+
+// jwtAlgorithms are the accepted HMAC signing algorithms. Anything else,
+// "none" included, is rejected.
+var jwtAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// userIDKey is the context key holding the authenticated user id
+type userIDKey struct{}
+
+// parseJWT verifies an HMAC-signed JWT and returns its subject. exp and nbf
+// are enforced when present.
+func parseJWT(token string, secret []byte, now time.Time) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", errTokenInvalid
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", errTokenInvalid
+	}
+	newHash, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return "", errTokenInvalid
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errTokenInvalid
+	}
+	mac := hmac.New(newHash, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return "", errTokenInvalid
+	}
+
+	var claims struct {
+		Sub string   `json:"sub"`
+		Exp *float64 `json:"exp"`
+		Nbf *float64 `json:"nbf"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil || claims.Sub == "" {
+		return "", errTokenInvalid
+	}
+	unix := float64(now.Unix())
+	if claims.Exp != nil && unix >= *claims.Exp {
+		return "", errTokenExpired
+	}
+	if claims.Nbf != nil && unix < *claims.Nbf {
+		return "", errTokenInvalid
+	}
+	return claims.Sub, nil
+}
+
+// decodeJWTPart decodes a base64url JSON segment of a JWT
+func decodeJWTPart(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// requireUser authenticates requests with an "Authorization: Bearer <jwt>"
+// header signed with secret, and puts the token's subject in the context
+// as the user id
+func requireUser(secret []byte) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Missing bearer token")
+				return
+			}
+
+			userID, err := parseJWT(token, secret, time.Now())
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				if err == errTokenExpired {
+					writeError(w, http.StatusUnauthorized, CodeTokenExpired, "Token has expired")
+					return
+				}
+				writeError(w, http.StatusUnauthorized, CodeUnauthorized, "Invalid token")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userIDKey{}, userID)))
+		})
+	}
+}
+
+// userIDFrom returns the authenticated user id, if any. It is empty when
+// JWT_SECRET is unset and todos are not scoped to users.
+func userIDFrom(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+// ownedBy narrows filter to the authenticated user's todos
+func ownedBy(ctx context.Context, filter bson.M) bson.M {
+	if userID := userIDFrom(ctx); userID != "" {
+		filter["user_id"] = userID
+	}
+	return filter
+}
+
+// ownsTodo reports whether the authenticated user may see todo
+func ownsTodo(ctx context.Context, todo Todo) bool {
+	userID := userIDFrom(ctx)
+	return userID == "" || todo.UserID == userID
+}
+
+// visible narrows filter to todos the request may see: its user's todos
+// that have not been soft deleted
+func visible(ctx context.Context, filter bson.M) bson.M {
+	return notDeleted(ownedBy(ctx, filter))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var testSecret = []byte("test-secret")
+
+// signJWT builds an HS256 token for claims. alg overrides the header's
+// algorithm, to build tokens the server must reject.
+func signJWT(t *testing.T, claims map[string]interface{}, secret []byte, alg string) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	unsigned := encode(map[string]string{"alg": alg, "typ": "JWT"}) + "." + encode(claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestParseJWT(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	tests := []struct {
+		name    string
+		token   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:  "valid",
+			token: signJWT(t, map[string]interface{}{"sub": "user-1", "exp": now.Add(time.Hour).Unix()}, testSecret, "HS256"),
+			want:  "user-1",
+		},
+		{
+			name:  "no expiry",
+			token: signJWT(t, map[string]interface{}{"sub": "user-1"}, testSecret, "HS256"),
+			want:  "user-1",
+		},
+		{
+			name:    "expired",
+			token:   signJWT(t, map[string]interface{}{"sub": "user-1", "exp": now.Add(-time.Second).Unix()}, testSecret, "HS256"),
+			wantErr: errTokenExpired,
+		},
+		{
+			name:    "expires now",
+			token:   signJWT(t, map[string]interface{}{"sub": "user-1", "exp": now.Unix()}, testSecret, "HS256"),
+			wantErr: errTokenExpired,
+		},
+		{
+			name:    "not yet valid",
+			token:   signJWT(t, map[string]interface{}{"sub": "user-1", "nbf": now.Add(time.Minute).Unix()}, testSecret, "HS256"),
+			wantErr: errTokenInvalid,
+		},
+		{
+			name:    "wrong secret",
+			token:   signJWT(t, map[string]interface{}{"sub": "user-1"}, []byte("other"), "HS256"),
+			wantErr: errTokenInvalid,
+		},
+		{
+			name:    "alg none",
+			token:   signJWT(t, map[string]interface{}{"sub": "user-1"}, testSecret, "none"),
+			wantErr: errTokenInvalid,
+		},
+		{
+			name:    "missing subject",
+			token:   signJWT(t, map[string]interface{}{"exp": now.Add(time.Hour).Unix()}, testSecret, "HS256"),
+			wantErr: errTokenInvalid,
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-jwt",
+			wantErr: errTokenInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseJWT(tt.token, testSecret, now)
+			if got != tt.want || err != tt.wantErr {
+				t.Errorf("got %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	var seenUser string
+	handler := requireUser(testSecret)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenUser = userIDFrom(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+		wantErr  string
+		wantUser string
+	}{
+		{
+			name:     "valid token",
+			header:   "Bearer " + signJWT(t, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(time.Hour).Unix()}, testSecret, "HS256"),
+			wantCode: http.StatusOK,
+			wantUser: "user-1",
+		},
+		{
+			name:     "expired token",
+			header:   "Bearer " + signJWT(t, map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()}, testSecret, "HS256"),
+			wantCode: http.StatusUnauthorized,
+			wantErr:  CodeTokenExpired,
+		},
+		{
+			name:     "invalid token",
+			header:   "Bearer " + signJWT(t, map[string]interface{}{"sub": "user-1"}, []byte("other"), "HS256"),
+			wantCode: http.StatusUnauthorized,
+			wantErr:  CodeUnauthorized,
+		},
+		{
+			name:     "missing header",
+			wantCode: http.StatusUnauthorized,
+			wantErr:  CodeUnauthorized,
+		},
+		{
+			name:     "other scheme",
+			header:   "Basic dXNlcjpwYXNz",
+			wantCode: http.StatusUnauthorized,
+			wantErr:  CodeUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seenUser = ""
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if seenUser != tt.wantUser {
+				t.Errorf("handler saw user %q, want %q", seenUser, tt.wantUser)
+			}
+			if tt.wantErr == "" {
+				return
+			}
+			if body := decodeError(t, rec); body["code"] != tt.wantErr {
+				t.Errorf("body = %v, want code %s", body, tt.wantErr)
+			}
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestOwnedBy(t *testing.T) {
+	if got := ownedBy(context.Background(), bson.M{"_id": 1}); !reflect.DeepEqual(got, bson.M{"_id": 1}) {
+		t.Errorf("without a user: got %v, want the filter unchanged", got)
+	}
+
+	ctx := context.WithValue(context.Background(), userIDKey{}, "user-1")
+	if got, want := visible(ctx, bson.M{"_id": 1}), (bson.M{"_id": 1, "user_id": "user-1", "deleted_at": nil}); !reflect.DeepEqual(got, want) {
+		t.Errorf("with a user: got %v, want %v", got, want)
+	}
+	if !ownsTodo(ctx, Todo{UserID: "user-1"}) || ownsTodo(ctx, Todo{UserID: "user-2"}) {
+		t.Error("ownsTodo does not compare the todo's user")
+	}
+}
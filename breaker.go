@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// Circuit breaker states
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker stops sending requests to MongoDB after repeated failures.
+// Once open it rejects requests for a cooldown, then lets a single probe
+// through (half-open). A successful probe closes the breaker; a failed one
+// reopens it with the cooldown doubled, up to maxCooldown.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	threshold    int
+	baseCooldown time.Duration
+	maxCooldown  time.Duration
+
+	state    string
+	failures int
+	cooldown time.Duration
+	openedAt time.Time
+	probing  bool
+}
+
+// newCircuitBreaker creates a closed breaker that opens after threshold
+// consecutive failures
+func newCircuitBreaker(threshold int, baseCooldown, maxCooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold:    threshold,
+		baseCooldown: baseCooldown,
+		maxCooldown:  maxCooldown,
+		state:        breakerClosed,
+		cooldown:     baseCooldown,
+	}
+}
+
+// allow reports whether a request may reach the database, and whether it
+// is the probe testing recovery
+func (cb *circuitBreaker) allow() (allowed, probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerOpen:
+		if time.Since(cb.openedAt) < cb.cooldown {
+			return false, false
+		}
+		cb.state = breakerHalfOpen
+		cb.probing = true
+		return true, true
+	case breakerHalfOpen:
+		// Only one probe at a time while testing recovery
+		if cb.probing {
+			return false, false
+		}
+		cb.probing = true
+		return true, true
+	default:
+		return true, false
+	}
+}
+
+// record updates the breaker with the outcome of an allowed request's
+// database calls. Only the probe can move a half-open breaker, and a
+// request that was let through before the breaker opened changes nothing
+// once it is open.
+func (cb *circuitBreaker) record(probe, success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case breakerClosed:
+		if success {
+			cb.failures = 0
+			return
+		}
+		cb.failures++
+		if cb.failures >= cb.threshold {
+			cb.open()
+		}
+	case breakerHalfOpen:
+		if !probe {
+			return
+		}
+		if success {
+			cb.state = breakerClosed
+			cb.failures = 0
+			cb.cooldown = cb.baseCooldown
+			cb.probing = false
+			return
+		}
+		cb.cooldown *= 2
+		if cb.cooldown > cb.maxCooldown {
+			cb.cooldown = cb.maxCooldown
+		}
+		cb.open()
+	}
+}
+
+// release hands the probe slot back when the probe request never reached
+// the database, so the next request can test recovery instead
+func (cb *circuitBreaker) release(probe bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if probe && cb.state == breakerHalfOpen {
+		cb.probing = false
+	}
+}
+
+// open trips the breaker; callers must hold mu
+func (cb *circuitBreaker) open() {
+	cb.state = breakerOpen
+	cb.openedAt = time.Now()
+	cb.probing = false
+}
+
+// retryAfter returns the time left until the breaker half-opens. While a
+// probe is in flight the cooldown has already passed, so clients are asked
+// to wait a second for its result.
+func (cb *circuitBreaker) retryAfter() time.Duration {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	remaining := cb.cooldown - time.Since(cb.openedAt)
+	if cb.state != breakerOpen || remaining < time.Second {
+		return time.Second
+	}
+	return remaining
+}
+
+// middleware fails fast with 503 DB_UNAVAILABLE while the breaker is open.
+// The breaker is driven by what happened to the request's MongoDB calls,
+// not by its response status, so overload rejections or bad input never
+// count either way.
+func (cb *circuitBreaker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, probe := cb.allow()
+		if !allowed {
+			seconds := int(math.Ceil(cb.retryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusServiceUnavailable, CodeDBUnavailable, "Database is unavailable, try again later")
+			return
+		}
+
+		outcome := &dbOutcome{}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), dbOutcomeKey{}, outcome)))
+
+		succeeded, failed := outcome.result()
+		switch {
+		case failed:
+			cb.record(probe, false)
+		case succeeded:
+			cb.record(probe, true)
+		default:
+			cb.release(probe)
+		}
+	})
+}
+
+// dbOutcome collects what happened to one request's MongoDB calls
+type dbOutcome struct {
+	mu        sync.Mutex
+	succeeded bool
+	failed    bool
+}
+
+// dbOutcomeKey is the context key holding the request's dbOutcome
+type dbOutcomeKey struct{}
+
+// result reports whether any call succeeded and whether any failed
+func (o *dbOutcome) result() (succeeded, failed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.succeeded, o.failed
+}
+
+// markDBSuccess notes a MongoDB command that completed for the request
+// behind ctx
+func markDBSuccess(ctx context.Context) {
+	if outcome, ok := ctx.Value(dbOutcomeKey{}).(*dbOutcome); ok {
+		outcome.mu.Lock()
+		outcome.succeeded = true
+		outcome.mu.Unlock()
+	}
+}
+
+// markDBFailure notes a MongoDB call that failed for the request behind ctx
+// because the database could not be reached or did not answer in time.
+// Other errors, such as a duplicate key, say nothing about availability.
+func markDBFailure(ctx context.Context, err error) {
+	var selectErr topology.ServerSelectionError
+	unavailable := errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) ||
+		mongo.IsNetworkError(err) || errors.As(err, &selectErr)
+	if !unavailable {
+		return
+	}
+	if outcome, ok := ctx.Value(dbOutcomeKey{}).(*dbOutcome); ok {
+		outcome.mu.Lock()
+		outcome.failed = true
+		outcome.mu.Unlock()
+	}
+}
+
+// breakerMonitor reports every successful MongoDB command to the breaker
+// of the request that issued it
+var breakerMonitor = &event.CommandMonitor{
+	Succeeded: func(ctx context.Context, _ *event.CommandSucceededEvent) {
+		markDBSuccess(ctx)
+	},
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// breakerState reads the state under the lock
+func breakerState(cb *circuitBreaker) string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	cb := newCircuitBreaker(2, 20*time.Millisecond, 50*time.Millisecond)
+
+	// Closed: a success in between resets the failure count
+	cb.record(false, false)
+	cb.record(false, true)
+	cb.record(false, false)
+	if got := breakerState(cb); got != breakerClosed {
+		t.Fatalf("after non-consecutive failures: state = %s, want closed", got)
+	}
+	cb.record(false, false)
+	if got := breakerState(cb); got != breakerOpen {
+		t.Fatalf("after %d failures: state = %s, want open", cb.threshold, got)
+	}
+
+	// Open: requests are rejected and late outcomes change nothing
+	if allowed, _ := cb.allow(); allowed {
+		t.Fatal("open breaker allowed a request")
+	}
+	cb.record(false, true)
+	if got := breakerState(cb); got != breakerOpen {
+		t.Fatalf("after a late success: state = %s, want open", got)
+	}
+
+	// Half-open: after the cooldown a single probe goes through
+	time.Sleep(cb.cooldown)
+	allowed, probe := cb.allow()
+	if !allowed || !probe {
+		t.Fatalf("after cooldown: allow() = %v, %v, want a probe", allowed, probe)
+	}
+	if got := breakerState(cb); got != breakerHalfOpen {
+		t.Fatalf("during probe: state = %s, want half-open", got)
+	}
+	if allowed, _ := cb.allow(); allowed {
+		t.Fatal("half-open breaker allowed a second request during the probe")
+	}
+	cb.record(false, true)
+	if got := breakerState(cb); got != breakerHalfOpen {
+		t.Fatalf("after a non-probe success: state = %s, want half-open", got)
+	}
+
+	// A failed probe reopens with the cooldown doubled
+	cb.record(true, false)
+	if got := breakerState(cb); got != breakerOpen {
+		t.Fatalf("after a failed probe: state = %s, want open", got)
+	}
+	if cb.cooldown != 40*time.Millisecond {
+		t.Errorf("after a failed probe: cooldown = %v, want 40ms", cb.cooldown)
+	}
+
+	// A probe that never reached the database frees the slot
+	time.Sleep(cb.cooldown)
+	_, probe = cb.allow()
+	cb.release(probe)
+	allowed, probe = cb.allow()
+	if !allowed || !probe {
+		t.Fatalf("after release: allow() = %v, %v, want a probe", allowed, probe)
+	}
+
+	// A successful probe closes and resets the cooldown
+	cb.record(true, true)
+	if got := breakerState(cb); got != breakerClosed {
+		t.Fatalf("after a successful probe: state = %s, want closed", got)
+	}
+	if cb.cooldown != cb.baseCooldown {
+		t.Errorf("after a successful probe: cooldown = %v, want %v", cb.cooldown, cb.baseCooldown)
+	}
+}
+
+func TestCircuitBreakerCooldownCap(t *testing.T) {
+	cb := newCircuitBreaker(1, 20*time.Millisecond, 30*time.Millisecond)
+	cb.record(false, false)
+
+	for i := 0; i < 3; i++ {
+		time.Sleep(cb.cooldown)
+		_, probe := cb.allow()
+		cb.record(probe, false)
+	}
+	if cb.cooldown != cb.maxCooldown {
+		t.Errorf("cooldown = %v, want it capped at %v", cb.cooldown, cb.maxCooldown)
+	}
+}
+
+func TestCircuitBreakerMiddleware(t *testing.T) {
+	cb := newCircuitBreaker(1, time.Minute, time.Minute)
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		cb.middleware(h).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil))
+		return rec
+	}
+
+	// Rejections that never reach the database do not count
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusServiceUnavailable, CodeOverloaded, "Server is overloaded, try again later")
+	})
+	if got := breakerState(cb); got != breakerClosed {
+		t.Fatalf("after OVERLOADED: state = %s, want closed", got)
+	}
+
+	// An unreachable database opens it
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		writeDatabaseError(r.Context(), w, context.DeadlineExceeded, "Failed to fetch todos")
+	})
+	if got := breakerState(cb); got != breakerOpen {
+		t.Fatalf("after a database timeout: state = %s, want open", got)
+	}
+
+	rec := serve(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("open breaker called the handler")
+	})
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("open: status = %d, want 503", rec.Code)
+	}
+	seconds, err := strconv.Atoi(rec.Header().Get("Retry-After"))
+	if err != nil || seconds < 1 || seconds > 60 {
+		t.Errorf("open: Retry-After = %q, want 1 to 60 seconds", rec.Header().Get("Retry-After"))
+	}
+}
+
+func TestCircuitBreakerRetryAfterDuringProbe(t *testing.T) {
+	cb := newCircuitBreaker(1, 10*time.Millisecond, 10*time.Millisecond)
+	cb.record(false, false)
+	time.Sleep(cb.cooldown)
+	cb.allow()
+
+	if got := cb.retryAfter(); got < time.Second {
+		t.Errorf("retryAfter() during probe = %v, want at least 1s", got)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxBulkItems caps the number of todos in one POST /todos/bulk request
+const maxBulkItems = 500
+
+// BulkResult is the outcome for one item of POST /todos/bulk, in request
+// order. Successful items carry id; failed ones carry error and code.
+type BulkResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// BulkCreateTodos handles POST /todos/bulk. Every valid item is inserted in
+// one unordered InsertMany, so a duplicate title or bad item only fails
+// that item. The response is always 207 Multi-Status with a result per
+// item.
+func (h *TodoHandler) BulkCreateTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	// Items are decoded one by one so a malformed item fails alone
+	var items []json.RawMessage
+	if !decodeBody(w, r, &items) {
+		return
+	}
+	if len(items) > maxBulkItems {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooManyItems, "At most 500 todos can be created per request")
+		return
+	}
+
+	now := time.Now()
+	results := make([]BulkResult, len(items))
+	var docs []interface{}
+	// docIndex maps a document back to its item
+	var docIndex []int
+	for i, item := range items {
+		results[i].Index = i
+
+		var todo Todo
+		if err := json.Unmarshal(item, &todo); err != nil {
+			results[i].Error, results[i].Code = "Invalid JSON", CodeInvalidJSON
+			if errors.Is(err, errInvalidDueDate) {
+				results[i].Error, results[i].Code = errInvalidDueDate.Error(), CodeInvalidDueDate
+			}
+			continue
+		}
+		if fieldErrors := h.validateFields(todo); len(fieldErrors) > 0 {
+			results[i].Error, results[i].Code = fieldErrors[0].Error, fieldErrors[0].Code
+			continue
+		}
+
+		syncStatus(&todo)
+		defaultPriority(&todo)
+		todo.Tags = normalizeTags(todo.Tags)
+		todo.ID = primitive.NewObjectID()
+		todo.UserID = userIDFrom(ctx)
+		todo.CreatedAt = now
+		todo.UpdatedAt = now
+		todo.Version = 1
+
+		results[i].ID = formatTodoID(todo.ID)
+		docs = append(docs, todo)
+		docIndex = append(docIndex, i)
+	}
+
+	if len(docs) > 0 {
+		_, err := h.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+		if err != nil {
+			var bulkErr mongo.BulkWriteException
+			if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+				writeDatabaseError(ctx, w, err, "Failed to create todos")
+				return
+			}
+
+			// Write errors index into docs; map them back to the items
+			for _, writeErr := range bulkErr.WriteErrors {
+				result := &results[docIndex[writeErr.Index]]
+				result.ID = ""
+				result.Error, result.Code = "Failed to create todo", CodeDatabaseError
+				if writeErr.Code == 11000 {
+					result.Error, result.Code = "Todo with this title already exists", CodeDuplicateTitle
+				}
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusMultiStatus)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"container/list"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// todoCache is a size-bounded LRU of single todos for GetTodo. Entries
+// expire after ttl and are dropped whenever their todo is written. A nil
+// *todoCache is a valid, always-missing cache.
+type todoCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[primitive.ObjectID]*list.Element
+	// gen advances on every invalidation so a read that started before a
+	// write cannot cache what it fetched
+	gen uint64
+}
+
+type cacheEntry struct {
+	id        primitive.ObjectID
+	todo      Todo
+	expiresAt time.Time
+}
+
+// newTodoCache returns an LRU holding up to size todos for ttl each
+func newTodoCache(size int, ttl time.Duration) *todoCache {
+	return &todoCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: map[primitive.ObjectID]*list.Element{},
+	}
+}
+
+// get returns the cached todo for id when present and not expired
+func (c *todoCache) get(id primitive.ObjectID) (Todo, bool) {
+	if c == nil {
+		return Todo{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[id]
+	if !ok {
+		return Todo{}, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, id)
+		return Todo{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.todo, true
+}
+
+// generation returns the current invalidation counter, to be read before
+// fetching a todo that will be passed to add
+func (c *todoCache) generation() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.gen
+}
+
+// add caches todo unless an invalidation happened since gen was read
+func (c *todoCache) add(todo Todo, gen uint64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.gen {
+		return
+	}
+
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[todo.ID]; ok {
+		elem.Value = &cacheEntry{id: todo.ID, todo: todo, expiresAt: expiresAt}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[todo.ID] = c.order.PushFront(&cacheEntry{id: todo.ID, todo: todo, expiresAt: expiresAt})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).id)
+	}
+}
+
+// invalidate drops the given todos after a write
+func (c *todoCache) invalidate(ids ...primitive.ObjectID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	for _, id := range ids {
+		if elem, ok := c.entries[id]; ok {
+			c.order.Remove(elem)
+			delete(c.entries, id)
+		}
+	}
+}
+
+// clear drops every entry, for bulk writes
+func (c *todoCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.order.Init()
+	c.entries = map[primitive.ObjectID]*list.Element{}
+}
+
+// readKey is the singleflight key GetTodo coalesces lookups of id under
+func (h *TodoHandler) readKey(id primitive.ObjectID) string {
+	return strconv.FormatUint(h.readEpoch.Load(), 10) + "/" + id.Hex()
+}
+
+// invalidate drops the given todos from the cache after a write and
+// detaches any GetTodo lookup of them still in flight, so requests that
+// arrive after the write don't join a read that started before it
+func (h *TodoHandler) invalidate(ids ...primitive.ObjectID) {
+	h.cache.invalidate(ids...)
+	for _, id := range ids {
+		h.reads.Forget(h.readKey(id))
+	}
+}
+
+// invalidateAll is invalidate for bulk writes; moving readEpoch detaches
+// every in-flight lookup at once
+func (h *TodoHandler) invalidateAll() {
+	h.cache.clear()
+	h.readEpoch.Add(1)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestTodoCacheHitAndMiss(t *testing.T) {
+	c := newTodoCache(10, time.Minute)
+	todo := Todo{ID: primitive.NewObjectID(), Title: "Buy milk"}
+
+	if _, ok := c.get(todo.ID); ok {
+		t.Fatal("empty cache: got a hit")
+	}
+	c.add(todo, c.generation())
+	got, ok := c.get(todo.ID)
+	if !ok || got.Title != todo.Title {
+		t.Fatalf("after add: got %+v, %v, want a hit", got, ok)
+	}
+	if _, ok := c.get(primitive.NewObjectID()); ok {
+		t.Error("other id: got a hit")
+	}
+}
+
+func TestTodoCacheExpiry(t *testing.T) {
+	c := newTodoCache(10, 10*time.Millisecond)
+	todo := Todo{ID: primitive.NewObjectID()}
+	c.add(todo, c.generation())
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.get(todo.ID); ok {
+		t.Error("expired entry: got a hit")
+	}
+}
+
+func TestTodoCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := newTodoCache(2, time.Minute)
+	a := Todo{ID: primitive.NewObjectID()}
+	b := Todo{ID: primitive.NewObjectID()}
+	d := Todo{ID: primitive.NewObjectID()}
+
+	c.add(a, c.generation())
+	c.add(b, c.generation())
+	c.get(a.ID)
+	c.add(d, c.generation())
+
+	if _, ok := c.get(b.ID); ok {
+		t.Error("least recently used entry was kept")
+	}
+	for _, id := range []primitive.ObjectID{a.ID, d.ID} {
+		if _, ok := c.get(id); !ok {
+			t.Errorf("%s was evicted", id.Hex())
+		}
+	}
+}
+
+func TestTodoCacheInvalidation(t *testing.T) {
+	c := newTodoCache(10, time.Minute)
+	a := Todo{ID: primitive.NewObjectID()}
+	b := Todo{ID: primitive.NewObjectID()}
+	c.add(a, c.generation())
+	c.add(b, c.generation())
+
+	c.invalidate(a.ID)
+	if _, ok := c.get(a.ID); ok {
+		t.Error("invalidated entry: got a hit")
+	}
+	if _, ok := c.get(b.ID); !ok {
+		t.Error("invalidating a dropped another entry")
+	}
+
+	c.clear()
+	if _, ok := c.get(b.ID); ok {
+		t.Error("after clear: got a hit")
+	}
+}
+
+func TestTodoCacheSkipsReadsOlderThanAWrite(t *testing.T) {
+	c := newTodoCache(10, time.Minute)
+	todo := Todo{ID: primitive.NewObjectID()}
+
+	// A read starts, a write lands, then the read finishes
+	gen := c.generation()
+	c.invalidate(todo.ID)
+	c.add(todo, gen)
+
+	if _, ok := c.get(todo.ID); ok {
+		t.Error("a read from before the write was cached")
+	}
+}
+
+func TestNilTodoCache(t *testing.T) {
+	var c *todoCache
+	id := primitive.NewObjectID()
+	c.add(Todo{ID: id}, c.generation())
+	c.invalidate(id)
+	c.clear()
+	if _, ok := c.get(id); ok {
+		t.Error("nil cache: got a hit")
+	}
+}
+
+func TestGetTodoCache(t *testing.T) {
+	// Count reads by id; the duplicate title check on update is not one
+	var finds atomic.Int32
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName == "find" && evt.Command.Lookup("filter", "title").Validate() != nil {
+				finds.Add(1)
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("invalidated by update", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		stored := func(description string) bson.D {
+			return bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}, {Key: "description", Value: description}}
+		}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, stored("")),
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: stored("2 litres")}},
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, stored("2 litres")),
+		)
+		h := NewTodoHandler(mt.Coll)
+		h.cache = newTodoCache(10, time.Minute)
+
+		get := func() string {
+			rec := httptest.NewRecorder()
+			h.GetTodo(rec, todoRequest(http.MethodGet, id))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("GET: status = %d, body %s", rec.Code, rec.Body)
+			}
+			var todo Todo
+			if err := json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+				t.Fatal(err)
+			}
+			return todo.Description
+		}
+
+		// Miss, then hit
+		if description := get(); description != "" {
+			t.Errorf("first GET: description = %q, want none", description)
+		}
+		if description := get(); description != "" {
+			t.Errorf("second GET: description = %q, want none", description)
+		}
+		if n := finds.Load(); n != 1 {
+			t.Errorf("after a hit: find ran %d times, want 1", n)
+		}
+
+		r := todoRequest(http.MethodPut, id)
+		r.Body = io.NopCloser(strings.NewReader(`{"title":"Buy milk","description":"2 litres"}`))
+		rec := httptest.NewRecorder()
+		h.UpdateTodo(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT: status = %d, body %s", rec.Code, rec.Body)
+		}
+
+		// The update dropped the entry, so the new description is read
+		if description := get(); description != "2 litres" {
+			t.Errorf("GET after update: description = %q, want 2 litres", description)
+		}
+		if n := finds.Load(); n != 2 {
+			t.Errorf("after the update: find ran %d times, want 2", n)
+		}
+	})
+}
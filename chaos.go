@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// chaosConfig controls fault injection for resilience testing
+type chaosConfig struct {
+	latencyProbability float64
+	maxLatency         time.Duration
+	errorProbability   float64
+}
+
+// loadChaosConfig reads the chaos settings from the environment. It returns
+// nil unless CHAOS=true, in which case no middleware should be installed.
+func loadChaosConfig() *chaosConfig {
+	if os.Getenv("CHAOS") != "true" {
+		return nil
+	}
+
+	config := &chaosConfig{
+		latencyProbability: 0.1,
+		maxLatency:         2 * time.Second,
+		errorProbability:   0.05,
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CHAOS_LATENCY_PROBABILITY"), 64); err == nil {
+		config.latencyProbability = v
+	}
+	if v, err := strconv.Atoi(os.Getenv("CHAOS_MAX_LATENCY_MS")); err == nil {
+		config.maxLatency = time.Duration(v) * time.Millisecond
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CHAOS_ERROR_PROBABILITY"), 64); err == nil {
+		config.errorProbability = v
+	}
+	return config
+}
+
+// chaosMiddleware randomly delays requests and fails some with 503 so client
+// retry and timeout handling can be exercised against a real deployment
+func chaosMiddleware(config *chaosConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.maxLatency > 0 && rand.Float64() < config.latencyProbability {
+				delay := time.Duration(rand.Int63n(int64(config.maxLatency)))
+				select {
+				case <-time.After(delay):
+				case <-r.Context().Done():
+					return
+				}
+			}
+
+			if rand.Float64() < config.errorProbability {
+				writeError(w, http.StatusServiceUnavailable, CodeChaos, "Injected failure")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
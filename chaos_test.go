@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLoadChaosConfigDisabledByDefault(t *testing.T) {
+	for _, value := range []string{"", "false", "1", "TRUE"} {
+		t.Setenv("CHAOS", value)
+		t.Setenv("CHAOS_ERROR_PROBABILITY", "1")
+		if config := loadChaosConfig(); config != nil {
+			t.Errorf("CHAOS=%q: got %+v, want no chaos", value, config)
+		}
+	}
+}
+
+func TestLoadChaosConfigEnabled(t *testing.T) {
+	t.Setenv("CHAOS", "true")
+	t.Setenv("CHAOS_LATENCY_PROBABILITY", "0.5")
+	t.Setenv("CHAOS_MAX_LATENCY_MS", "100")
+	t.Setenv("CHAOS_ERROR_PROBABILITY", "0.25")
+
+	config := loadChaosConfig()
+	if config == nil {
+		t.Fatal("CHAOS=true: got no chaos config")
+	}
+	if config.latencyProbability != 0.5 || config.maxLatency != 100*time.Millisecond || config.errorProbability != 0.25 {
+		t.Errorf("got %+v, want the configured probabilities and latency", config)
+	}
+}
+
+func TestChaosMiddlewareWithoutFaults(t *testing.T) {
+	handler := chaosMiddleware(&chaosConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for i := 0; i < 100; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil))
+		if rec.Code != http.StatusTeapot {
+			t.Fatalf("status = %d, want the handler's 418", rec.Code)
+		}
+	}
+}
+
+func TestChaosMiddlewareInjectsFailures(t *testing.T) {
+	handler := chaosMiddleware(&chaosConfig{errorProbability: 1})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler ran despite an injected failure")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", rec.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// FieldDiff holds the two values of a field that differs between todos
+type FieldDiff struct {
+	A interface{} `json:"a"`
+	B interface{} `json:"b"`
+}
+
+// diffTodos compares two todos field by field using their JSON form, so any
+// field added to Todo is compared automatically. The id is never reported.
+func diffTodos(a, b Todo) (map[string]FieldDiff, error) {
+	fieldsA, err := todoFields(a)
+	if err != nil {
+		return nil, err
+	}
+	fieldsB, err := todoFields(b)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := map[string]FieldDiff{}
+	for name, valueA := range fieldsA {
+		if name == "id" {
+			continue
+		}
+		if valueB, ok := fieldsB[name]; !ok || !reflect.DeepEqual(valueA, valueB) {
+			diff[name] = FieldDiff{A: valueA, B: fieldsB[name]}
+		}
+	}
+	for name, valueB := range fieldsB {
+		if _, ok := fieldsA[name]; !ok && name != "id" {
+			diff[name] = FieldDiff{A: nil, B: valueB}
+		}
+	}
+	return diff, nil
+}
+
+// changedFields returns the fields whose values differ from before to
+// after, with their new values, plus the id and updated_at
+func changedFields(before, after Todo) (map[string]interface{}, error) {
+	diff, err := diffTodos(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]interface{}{
+		"id":         formatTodoID(after.ID),
+		"updated_at": after.UpdatedAt,
+	}
+	for name, values := range diff {
+		changes[name] = values.B
+	}
+	return changes, nil
+}
+
+// todoFields flattens a todo into its JSON field values
+func todoFields(todo Todo) (map[string]interface{}, error) {
+	data, err := json.Marshal(todo)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
+
+// DiffTodos handles GET /todos/diff?a={id}&b={id}
+func (h *TodoHandler) DiffTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	var todos [2]Todo
+	for i, param := range []string{"a", "b"} {
+		id, err := parseTodoID(r.URL.Query().Get(param))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID in parameter "+param)
+			return
+		}
+
+		err = h.readCollection.FindOne(ctx, visible(ctx, bson.M{"_id": id})).Decode(&todos[i])
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				writeError(w, http.StatusNotFound, CodeNotFound, "Todo "+param+" not found")
+			} else {
+				writeDatabaseError(ctx, w, err, "Failed to fetch todo")
+			}
+			return
+		}
+	}
+
+	diff, err := diffTodos(todos[0], todos[1])
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, CodeInternalError, "Failed to compare todos")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"a":           formatTodoID(todos[0].ID),
+		"b":           formatTodoID(todos[1].ID),
+		"identical":   len(diff) == 0,
+		"differences": diff,
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// errInvalidDueDate is returned when decoding a due_date that is not RFC3339
+var errInvalidDueDate = errors.New("due_date must be an RFC3339 timestamp")
+
+// decodeDueDate parses a raw due_date from a request body. An absent or
+// null value yields nil.
+func decodeDueDate(raw json.RawMessage) (*time.Time, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, errInvalidDueDate
+	}
+	dueDate, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errInvalidDueDate
+	}
+	dueDate = dueDate.UTC()
+	return &dueDate, nil
+}
+
+// writeInvalidDueDate reports a due_date that did not parse
+func writeInvalidDueDate(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, CodeInvalidDueDate, errInvalidDueDate.Error())
+}
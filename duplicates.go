@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultDuplicateDistance is the edit distance between normalized titles
+// at or below which two todos are reported as likely duplicates
+const defaultDuplicateDistance = 2
+
+// maxDuplicateCandidates caps the todos GET /todos/duplicates compares, since
+// every pair of titles of similar length is checked
+const maxDuplicateCandidates = 5000
+
+// normalizeTitle lowercases a title, drops punctuation and collapses
+// whitespace, so "Buy Milk!" and "buy  milk" compare equal
+func normalizeTitle(title string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		case unicode.IsSpace(r):
+			space = true
+		}
+	}
+	return b.String()
+}
+
+// levenshtein returns the edit distance between a and b, giving up with
+// max+1 once the distance is known to exceed max
+func levenshtein(a, b []rune, max int) int {
+	if diff := len(a) - len(b); diff > max || -diff > max {
+		return max + 1
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// groupDuplicates clusters todos whose normalized titles are within
+// maxDistance edits of each other. Similarity is transitive, so a chain of
+// close titles ends up in one group. Todos without a near match are left
+// out.
+func groupDuplicates(todos []Todo, maxDistance int) [][]Todo {
+	titles := make([][]rune, len(todos))
+	for i, todo := range todos {
+		titles[i] = []rune(normalizeTitle(todo.Title))
+	}
+
+	parent := make([]int, len(todos))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	// Titles more than maxDistance runes apart in length cannot be within
+	// maxDistance edits, so with the todos ordered by title length each one
+	// is only compared with the next few
+	order := make([]int, len(todos))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return len(titles[order[a]]) < len(titles[order[b]])
+	})
+
+	for n, i := range order {
+		for _, j := range order[n+1:] {
+			if len(titles[j])-len(titles[i]) > maxDistance {
+				break
+			}
+			if find(i) == find(j) {
+				continue
+			}
+			if levenshtein(titles[i], titles[j], maxDistance) <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]Todo{}
+	var roots []int
+	for i, todo := range todos {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			roots = append(roots, root)
+		}
+		members[root] = append(members[root], todo)
+	}
+
+	groups := [][]Todo{}
+	for _, root := range roots {
+		if len(members[root]) > 1 {
+			groups = append(groups, members[root])
+		}
+	}
+	return groups
+}
+
+// FindDuplicateTodos handles GET /todos/duplicates
+func (h *TodoHandler) FindDuplicateTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	maxDistance := defaultDuplicateDistance
+	if raw := r.URL.Query().Get("max_distance"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 || n > 10 {
+			writeError(w, http.StatusBadRequest, CodeInvalidMaxDistance, "max_distance must be an integer between 0 and 10")
+			return
+		}
+		maxDistance = n
+	}
+
+	opts := options.Find().SetLimit(maxDuplicateCandidates + 1)
+	cursor, err := h.readCollection.Find(ctx, visible(ctx, bson.M{}), opts)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to fetch todos")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var todos []Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to decode todos")
+		return
+	}
+	if len(todos) > maxDuplicateCandidates {
+		writeError(w, http.StatusBadRequest, CodeTooManyItems, "At most 5000 todos can be checked for duplicates")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"groups": groupDuplicates(todos, maxDistance),
+	})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := map[string]string{
+		"Buy Milk!":        "buy milk",
+		"  buy   milk  ":   "buy milk",
+		"Call mom, today.": "call mom today",
+		"Café #2":          "café 2",
+		"!!!":              "",
+	}
+	for title, want := range tests {
+		if got := normalizeTitle(title); got != want {
+			t.Errorf("normalizeTitle(%q) = %q, want %q", title, got, want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		max  int
+		want int
+	}{
+		{"", "", 2, 0},
+		{"milk", "milk", 2, 0},
+		{"milk", "silk", 2, 1},
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3}, // gives up past max
+		{"a", "abcdef", 2, 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein([]rune(tt.a), []rune(tt.b), tt.max); got != tt.want {
+			t.Errorf("levenshtein(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.max, got, tt.want)
+		}
+	}
+}
+
+// groupTitles returns the titles of each group, for comparison
+func groupTitles(groups [][]Todo) [][]string {
+	titles := [][]string{}
+	for _, group := range groups {
+		var names []string
+		for _, todo := range group {
+			names = append(names, todo.Title)
+		}
+		titles = append(titles, names)
+	}
+	return titles
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	todos := []Todo{
+		{Title: "Buy milk"},
+		{Title: "Walk the dog"},
+		{Title: "Buy Milk!"},
+		{Title: "buy silk"},
+		{Title: "Pay rent"},
+		{Title: "Walk the dogs"},
+		{Title: "Write the quarterly report"},
+	}
+
+	got := groupTitles(groupDuplicates(todos, 2))
+	want := [][]string{
+		{"Buy milk", "Buy Milk!", "buy silk"},
+		{"Walk the dog", "Walk the dogs"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Exact matches only, after normalization
+	got = groupTitles(groupDuplicates(todos, 0))
+	want = [][]string{{"Buy milk", "Buy Milk!"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("max distance 0: got %v, want %v", got, want)
+	}
+}
+
+func TestGroupDuplicatesChains(t *testing.T) {
+	// Each title is one edit from the next, so all end up together even
+	// though the ends are further apart, and length order does not matter
+	todos := []Todo{{Title: "abcd"}, {Title: "ab"}, {Title: "abc"}, {Title: "xyz"}}
+
+	got := groupTitles(groupDuplicates(todos, 1))
+	want := [][]string{{"abcd", "ab", "abc"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGroupDuplicatesNone(t *testing.T) {
+	if groups := groupDuplicates(nil, 2); len(groups) != 0 {
+		t.Errorf("no todos: got %v", groups)
+	}
+	if groups := groupDuplicates([]Todo{{Title: "one"}, {Title: "something else"}}, 2); len(groups) != 0 {
+		t.Errorf("distinct titles: got %v", groups)
+	}
+}
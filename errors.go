@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of every error response. They
+// are part of the API contract, so existing values must not change.
+const (
+	// Request problems
+	CodeEmptyBody          = "EMPTY_BODY"
+	CodeInvalidJSON        = "INVALID_JSON"
+	CodeInvalidID          = "INVALID_ID"
+	CodeInvalidBool        = "INVALID_BOOL"
+	CodeInvalidTimezone    = "INVALID_TIMEZONE"
+	CodeInvalidPage        = "INVALID_PAGE"
+	CodeInvalidLimit       = "INVALID_LIMIT"
+	CodeInvalidSort        = "INVALID_SORT"
+	CodeInvalidOrder       = "INVALID_ORDER"
+	CodeInvalidBefore      = "INVALID_BEFORE"
+	CodeInvalidMaxDistance = "INVALID_MAX_DISTANCE"
+	CodeInvalidIfMatch     = "INVALID_IF_MATCH"
+	CodeTooManyItems       = "TOO_MANY_ITEMS"
+	CodeConflictingFilters = "CONFLICTING_FILTERS"
+
+	// Todo field validation
+	CodeMissingTitle       = "MISSING_TITLE"
+	CodeTitleRejected      = "TITLE_REJECTED"
+	CodeDuplicateTitle     = "DUPLICATE_TITLE"
+	CodeInvalidStatus      = "INVALID_STATUS"
+	CodeInvalidPriority    = "INVALID_PRIORITY"
+	CodeInvalidDueDate     = "INVALID_DUE_DATE"
+	CodeInvalidHiddenUntil = "INVALID_HIDDEN_UNTIL"
+	CodeInvalidMetadata    = "INVALID_METADATA"
+	CodeInvalidMetadataKey = "INVALID_METADATA_KEY"
+	CodeInvalidTransition  = "INVALID_TRANSITION"
+	CodeInvalidMerge       = "INVALID_MERGE"
+
+	// Lookups and concurrency
+	CodeNotFound               = "NOT_FOUND"
+	CodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	CodeVersionConflict        = "VERSION_CONFLICT"
+	CodeStaleDelete            = "STALE_DELETE"
+	CodeConcurrentModification = "CONCURRENT_MODIFICATION"
+
+	// Authentication and admin endpoints
+	CodeForbidden            = "FORBIDDEN"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodeTokenExpired         = "TOKEN_EXPIRED"
+	CodeConfirmationRequired = "CONFIRMATION_REQUIRED"
+	CodeInvalidSnapshot      = "INVALID_SNAPSHOT"
+	CodeRestoreFailed        = "RESTORE_FAILED"
+
+	// Server and database failures
+	CodeDatabaseError = "DATABASE_ERROR"
+	CodeDBTimeout     = "DB_TIMEOUT"
+	CodeDBUnavailable = "DB_UNAVAILABLE"
+	CodeOverloaded    = "OVERLOADED"
+	CodeInternalError = "INTERNAL_ERROR"
+	CodeChaos         = "CHAOS"
+)
+
+// writeError writes the JSON error body used by every endpoint:
+// {"error": message, "code": code}
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+		"code":  code,
+	})
+}
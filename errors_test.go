@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// decodeError checks that a response is a JSON error and returns its body
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	if got := rec.Header().Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+	var body map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+	}
+	return body
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, http.StatusNotFound, CodeNotFound, "Route not found")
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	body := decodeError(t, rec)
+	if body["code"] != CodeNotFound || body["error"] != "Route not found" {
+		t.Errorf("body = %v", body)
+	}
+}
+
+func TestDeleteTodoNotFoundIsJSON(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("missing", func(mt *mtest.T) {
+		// The soft delete matches nothing
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}})
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.DeleteTodo(rec, todoRequest(http.MethodDelete, primitive.NewObjectID()))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+		if body := decodeError(t, rec); body["code"] != CodeNotFound {
+			t.Errorf("body = %v, want code %s", body, CodeNotFound)
+		}
+	})
+}
+
+func TestDeleteTodoInvalidIDIsJSON(t *testing.T) {
+	h := NewTodoHandler(nil)
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodDelete, "/api/v1/todos/nope", nil), map[string]string{"id": "nope"})
+
+	rec := httptest.NewRecorder()
+	h.DeleteTodo(rec, r)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", rec.Code)
+	}
+	if body := decodeError(t, rec); body["code"] != CodeInvalidID {
+		t.Errorf("body = %v, want code %s", body, CodeInvalidID)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// listETag builds a weak ETag for a filtered list from the number of
+// matching todos and their latest updated_at. Any create, update or delete
+// in the view changes one of the two. The query string is folded in because
+// parameters such as tz change the body without changing the documents.
+func (h *TodoHandler) listETag(ctx context.Context, r *http.Request, filter bson.M) (string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        nil,
+			"count":      bson.M{"$sum": 1},
+			"updated_at": bson.M{"$max": "$updated_at"},
+		}}},
+	}
+
+	cursor, err := h.readCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return "", err
+	}
+	defer cursor.Close(ctx)
+
+	var summary struct {
+		Count     int64     `bson:"count"`
+		UpdatedAt time.Time `bson:"updated_at"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&summary); err != nil {
+			return "", err
+		}
+	} else if err := cursor.Err(); err != nil {
+		return "", err
+	}
+
+	query := fnv.New32a()
+	query.Write([]byte(r.URL.RawQuery))
+
+	return fmt.Sprintf(`W/"%d-%d-%x"`, summary.Count, summary.UpdatedAt.UnixMilli(), query.Sum32()), nil
+}
+
+// etagMatches reports whether an If-None-Match header matches etag. Weak
+// comparison is used, so the W/ prefix is ignored on both sides.
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	if strings.TrimSpace(ifNoneMatch) == "*" {
+		return true
+	}
+
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestETagMatches(t *testing.T) {
+	const etag = `W/"2-1700000000000-1a2b3c4d"`
+	tests := []struct {
+		ifNoneMatch string
+		want        bool
+	}{
+		{"", false},
+		{"*", true},
+		{` * `, true},
+		{etag, true},
+		{`"2-1700000000000-1a2b3c4d"`, true},
+		{`W/"1-1", ` + etag, true},
+		{`W/"1-1",W/"2-2"`, false},
+		{`W/"2-1700000000000-1a2b3c4e"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.ifNoneMatch, etag); got != tt.want {
+			t.Errorf("etagMatches(%q) = %v, want %v", tt.ifNoneMatch, got, tt.want)
+		}
+	}
+}
+
+// listSummary is the aggregate response listETag reads
+func listSummary(count int, updatedAt time.Time) bson.D {
+	return mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+		bson.D{{Key: "_id", Value: nil}, {Key: "count", Value: count}, {Key: "updated_at", Value: updatedAt}})
+}
+
+func TestListETagChangesWhenATodoChanges(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("update", func(mt *mtest.T) {
+		before := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(
+			listSummary(2, before),
+			listSummary(2, before),
+			// A todo in the view was updated
+			listSummary(2, before.Add(time.Second)),
+		)
+		h := NewTodoHandler(mt.Coll)
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil)
+
+		var etags []string
+		for i := 0; i < 3; i++ {
+			etag, err := h.listETag(context.Background(), r, bson.M{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			etags = append(etags, etag)
+		}
+
+		if etags[0] != etags[1] {
+			t.Errorf("unchanged list: ETag went from %s to %s", etags[0], etags[1])
+		}
+		if etags[1] == etags[2] {
+			t.Errorf("updated todo: ETag stayed %s", etags[1])
+		}
+	})
+}
+
+func TestGetTodosNotModified(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("if-none-match", func(mt *mtest.T) {
+		updatedAt := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(listSummary(2, updatedAt), listSummary(2, updatedAt))
+		h := NewTodoHandler(mt.Coll)
+
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil)
+		etag, err := h.listETag(context.Background(), r, bson.M{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		r.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		h.GetTodos(rec, r)
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("status = %d, want 304", rec.Code)
+		}
+		if got := rec.Header().Get("ETag"); got != etag {
+			t.Errorf("ETag = %s, want %s", got, etag)
+		}
+	})
+}
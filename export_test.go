@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// flushRecorder records how many rows had been written at each flush
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushedRows []int
+}
+
+func (rec *flushRecorder) Flush() {
+	rec.flushedRows = append(rec.flushedRows, strings.Count(rec.Body.String(), "\n")-1)
+	rec.ResponseRecorder.Flush()
+}
+
+func TestExportTodosCSVStreamsLargeCursor(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("large cursor", func(mt *mtest.T) {
+		const batches, batchSize = 3, 1000
+		for b := 0; b < batches; b++ {
+			docs := make([]bson.D, batchSize)
+			for i := range docs {
+				docs[i] = bson.D{
+					{Key: "_id", Value: primitive.NewObjectID()},
+					{Key: "title", Value: fmt.Sprintf("Todo %d", b*batchSize+i)},
+				}
+			}
+			// The last batch closes the cursor
+			cursorID, batch := int64(42), mtest.NextBatch
+			if b == 0 {
+				batch = mtest.FirstBatch
+			}
+			if b == batches-1 {
+				cursorID = 0
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(cursorID, "todoapp.todos", batch, docs...))
+		}
+		h := NewTodoHandler(mt.Coll)
+
+		rec := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+		h.ExportTodosCSV(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos/export.csv", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("parsing CSV: %v", err)
+		}
+		if got, want := len(records), batches*batchSize+1; got != want {
+			t.Fatalf("got %d records, want %d including the header", got, want)
+		}
+		if got := records[len(records)-1][1]; got != fmt.Sprintf("Todo %d", batches*batchSize-1) {
+			t.Errorf("last title = %q, want the last document", got)
+		}
+
+		// Rows are flushed as they stream, not once at the end
+		if got, want := len(rec.flushedRows), batches*batchSize/exportFlushRows; got < want {
+			t.Fatalf("flushed %d times, want at least %d", got, want)
+		}
+		if got := rec.flushedRows[0]; got != exportFlushRows {
+			t.Errorf("first flush after %d rows, want %d", got, exportFlushRows)
+		}
+	})
+}
+
+func TestExportTodosCSVColumns(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("columns", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+			bson.D{
+				{Key: "_id", Value: id},
+				{Key: "title", Value: "Buy milk"},
+				{Key: "status", Value: StatusInProgress},
+				{Key: "priority", Value: PriorityHigh},
+				{Key: "due_date", Value: at},
+				{Key: "tags", Value: bson.A{"errands", "dairy"}},
+				{Key: "created_at", Value: at},
+				{Key: "updated_at", Value: at},
+			},
+			// Stored before status, priority, due dates and tags existed
+			bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Walk the dog"}, {Key: "completed", Value: true}},
+		))
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.ExportTodosCSV(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos/export.csv", nil))
+		records, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatalf("parsing CSV: %v", err)
+		}
+
+		want := [][]string{
+			{"id", "title", "description", "completed", "status", "priority", "due_date", "tags", "created_at", "updated_at"},
+			{id.Hex(), "Buy milk", "", "false", StatusInProgress, PriorityHigh, "2024-05-01T12:00:00Z", "errands;dairy", "2024-05-01T12:00:00Z", "2024-05-01T12:00:00Z"},
+			{id.Hex(), "Walk the dog", "", "true", StatusDone, PriorityMedium, "", "", "0001-01-01T00:00:00Z", "0001-01-01T00:00:00Z"},
+		}
+		if !reflect.DeepEqual(records, want) {
+			t.Errorf("got\n%q\nwant\n%q", records, want)
+		}
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fieldTimestamps enables per-field change times in field_updated_at, from
+// FIELD_TIMESTAMPS=true. Off by default to keep documents small.
+var fieldTimestamps = os.Getenv("FIELD_TIMESTAMPS") == "true"
+
+// trackedFields are the fields with their own change time. Metadata is left
+// out because stored and incoming maps may order keys differently, which
+// would make every write look like a change.
+var trackedFields = []string{"title", "description", "completed", "status"}
+
+// literalSet builds a pipeline $set stage for plain values, wrapping each in
+// $literal so user text starting with "$" is not read as a field path
+func literalSet(values bson.M) bson.D {
+	set := bson.M{}
+	for field, value := range values {
+		set[field] = bson.M{"$literal": value}
+	}
+	return bson.D{{Key: "$set", Value: set}}
+}
+
+// withFieldTimestamps wraps update pipeline stages so that
+// field_updated_at.<field> is set to now for each tracked field whose value
+// the stages actually change. Old values are stashed first and compared
+// afterwards, which keeps the whole update atomic.
+func withFieldTimestamps(stages mongo.Pipeline, now time.Time) mongo.Pipeline {
+	previous := bson.M{}
+	stamps := bson.M{}
+	for _, field := range trackedFields {
+		previous[field] = "$" + field
+		stamps["field_updated_at."+field] = bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$" + field, "$_previous." + field}},
+			"$field_updated_at." + field,
+			now,
+		}}
+	}
+
+	pipeline := mongo.Pipeline{{{Key: "$set", Value: bson.M{"_previous": previous}}}}
+	pipeline = append(pipeline, stages...)
+	return append(pipeline,
+		bson.D{{Key: "$set", Value: stamps}},
+		bson.D{{Key: "$unset", Value: "_previous"}},
+	)
+}
+
+// setUpdate returns an update writing values and bumping the version,
+// tracking field change times when they are enabled
+func setUpdate(values bson.M, now time.Time) interface{} {
+	if !fieldTimestamps {
+		return bson.M{"$set": values, "$inc": bson.M{"version": 1}}
+	}
+	return withFieldTimestamps(mongo.Pipeline{literalSet(values), versionIncrement}, now)
+}
+
+// stampChangedFields mirrors withFieldTimestamps for a todo rebuilt in
+// memory from the pre-update document
+func stampChangedFields(before Todo, after *Todo, now time.Time) {
+	if !fieldTimestamps {
+		return
+	}
+
+	changed := map[string]bool{
+		"title":       before.Title != after.Title,
+		"description": before.Description != after.Description,
+		"completed":   before.Completed != after.Completed,
+		"status":      before.Status != after.Status,
+	}
+
+	stamps := make(map[string]time.Time, len(before.FieldUpdatedAt)+len(changed))
+	for field, at := range before.FieldUpdatedAt {
+		stamps[field] = at
+	}
+	for field, isChanged := range changed {
+		if isChanged {
+			stamps[field] = now
+		}
+	}
+	if len(stamps) > 0 {
+		after.FieldUpdatedAt = stamps
+	}
+}
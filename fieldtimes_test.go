@@ -0,0 +1,88 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestStampChangedFields(t *testing.T) {
+	defer func(enabled bool) { fieldTimestamps = enabled }(fieldTimestamps)
+	fieldTimestamps = true
+
+	earlier := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := earlier.Add(time.Hour)
+	before := Todo{
+		Title:       "Buy milk",
+		Description: "1 litre",
+		Status:      StatusTodo,
+		FieldUpdatedAt: map[string]time.Time{
+			"title":       earlier,
+			"description": earlier,
+			"completed":   earlier,
+			"status":      earlier,
+		},
+	}
+	after := before
+	after.Description = "2 litres"
+	after.Metadata = map[string]string{"shop": "corner"}
+
+	stampChangedFields(before, &after, now)
+	want := map[string]time.Time{
+		"title":       earlier,
+		"description": now,
+		"completed":   earlier,
+		"status":      earlier,
+	}
+	if !reflect.DeepEqual(after.FieldUpdatedAt, want) {
+		t.Errorf("field_updated_at = %v, want only description advanced", after.FieldUpdatedAt)
+	}
+	if before.FieldUpdatedAt["description"] != earlier {
+		t.Error("stampChangedFields modified the previous todo's timestamps")
+	}
+
+	// Disabled, nothing is recorded
+	fieldTimestamps = false
+	after = Todo{Title: "Walk the dog"}
+	stampChangedFields(Todo{}, &after, now)
+	if after.FieldUpdatedAt != nil {
+		t.Errorf("disabled: field_updated_at = %v, want none", after.FieldUpdatedAt)
+	}
+}
+
+func TestWithFieldTimestamps(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	stage := literalSet(bson.M{"description": "2 litres"})
+
+	pipeline := withFieldTimestamps(mongo.Pipeline{stage}, now)
+	if len(pipeline) != 4 {
+		t.Fatalf("got %d stages, want stash, update, stamp and unset", len(pipeline))
+	}
+	if !reflect.DeepEqual(pipeline[1], stage) {
+		t.Errorf("update stage = %v, want it passed through unchanged", pipeline[1])
+	}
+	if !reflect.DeepEqual(pipeline[3], bson.D{{Key: "$unset", Value: "_previous"}}) {
+		t.Errorf("last stage = %v, want _previous removed", pipeline[3])
+	}
+
+	// Each stamp keeps its old value unless the field differs from the
+	// value stashed before the update
+	previous := pipeline[0][0].Value.(bson.M)["_previous"].(bson.M)
+	stamps := pipeline[2][0].Value.(bson.M)
+	for _, field := range trackedFields {
+		if previous[field] != "$"+field {
+			t.Errorf("_previous.%s = %v, want $%s", field, previous[field], field)
+		}
+		want := bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{"$" + field, "$_previous." + field}},
+			"$field_updated_at." + field,
+			now,
+		}}
+		if got := stamps["field_updated_at."+field]; !reflect.DeepEqual(got, want) {
+			t.Errorf("field_updated_at.%s = %v, want %v", field, got, want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		port, host, target, want string
+	}{
+		{"443", "example.com", "/api/v1/todos?page=2", "https://example.com/api/v1/todos?page=2"},
+		{"443", "example.com:80", "/api/v1/todos", "https://example.com/api/v1/todos"},
+		{"8443", "example.com:8080", "/health", "https://example.com:8443/health"},
+		{"8443", "[::1]:8080", "/", "https://[::1]:8443/"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, tt.target, nil)
+		r.Host = tt.host
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.port).ServeHTTP(rec, r)
+
+		if rec.Code != http.StatusMovedPermanently {
+			t.Errorf("%s%s: status = %d, want 301", tt.host, tt.target, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tt.want {
+			t.Errorf("%s%s: Location = %q, want %q", tt.host, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	handler := hsts(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil)
+	r.TLS = &tls.ConnectionState{}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if got, want := rec.Header().Get("Strict-Transport-Security"), "max-age=31536000; includeSubDomains"; got != want {
+		t.Errorf("over TLS: Strict-Transport-Security = %q, want %q", got, want)
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("over TLS: status = %d, want the handler's 204", rec.Code)
+	}
+
+	// Browsers ignore the header over plain HTTP, so it is not sent there
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil))
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("plain HTTP: Strict-Transport-Security = %q, want none", got)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// base62Alphabet orders digits before letters so encoded ids sort like the
+// underlying ObjectIDs
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// base62IDLength is the fixed width of an encoded 12-byte ObjectID; shorter
+// values are left-padded with zeros
+const base62IDLength = 17
+
+// base62IDs switches ids in responses to the short base62 form. Hex ids are
+// accepted in requests either way.
+var base62IDs = os.Getenv("ID_FORMAT") == "base62"
+
+// errInvalidTodoID is returned for ids in neither hex nor base62 form
+var errInvalidTodoID = errors.New("invalid todo ID")
+
+// encodeBase62ID renders an ObjectID as a fixed-width base62 string
+func encodeBase62ID(id primitive.ObjectID) string {
+	n := new(big.Int).SetBytes(id[:])
+	base := big.NewInt(62)
+	remainder := new(big.Int)
+
+	encoded := make([]byte, base62IDLength)
+	for i := base62IDLength - 1; i >= 0; i-- {
+		n.DivMod(n, base, remainder)
+		encoded[i] = base62Alphabet[remainder.Int64()]
+	}
+	return string(encoded)
+}
+
+// decodeBase62ID parses the output of encodeBase62ID
+func decodeBase62ID(s string) (primitive.ObjectID, error) {
+	if len(s) != base62IDLength {
+		return primitive.NilObjectID, errInvalidTodoID
+	}
+
+	n := new(big.Int)
+	base := big.NewInt(62)
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(base62Alphabet, s[i])
+		if digit < 0 {
+			return primitive.NilObjectID, errInvalidTodoID
+		}
+		n.Mul(n, base)
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+
+	var id primitive.ObjectID
+	if n.BitLen() > len(id)*8 {
+		return primitive.NilObjectID, errInvalidTodoID
+	}
+	n.FillBytes(id[:])
+	return id, nil
+}
+
+// parseTodoID accepts a todo id as 24-character hex or 17-character base62
+func parseTodoID(s string) (primitive.ObjectID, error) {
+	if len(s) == 24 {
+		id, err := primitive.ObjectIDFromHex(s)
+		if err != nil {
+			return primitive.NilObjectID, errInvalidTodoID
+		}
+		return id, nil
+	}
+	return decodeBase62ID(s)
+}
+
+// formatTodoID renders an id in the configured response format
+func formatTodoID(id primitive.ObjectID) string {
+	if base62IDs {
+		return encodeBase62ID(id)
+	}
+	return id.Hex()
+}
+
+// todoJSON has Todo's fields without its JSON methods
+type todoJSON Todo
+
+// MarshalJSON writes the id in the configured format. Todos stored before
+// priorities or statuses existed are reported as medium, with the status
+// their completed flag implies.
+func (t Todo) MarshalJSON() ([]byte, error) {
+	defaultPriority(&t)
+	t.Status = currentStatus(t)
+	return json.Marshal(struct {
+		ID string `json:"id"`
+		todoJSON
+	}{formatTodoID(t.ID), todoJSON(t)})
+}
+
+// UnmarshalJSON accepts the id in either format and requires due_date to be
+// RFC3339. user_id and deleted_at are managed by the server and ignored.
+func (t *Todo) UnmarshalJSON(data []byte) error {
+	aux := struct {
+		*todoJSON
+		ID        string          `json:"id"`
+		DueDate   json.RawMessage `json:"due_date"`
+		UserID    json.RawMessage `json:"user_id"`
+		DeletedAt json.RawMessage `json:"deleted_at"`
+	}{todoJSON: (*todoJSON)(t)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	dueDate, err := decodeDueDate(aux.DueDate)
+	if err != nil {
+		return err
+	}
+	t.DueDate = dueDate
+
+	if aux.ID != "" {
+		id, err := parseTodoID(aux.ID)
+		if err != nil {
+			return err
+		}
+		t.ID = id
+	}
+	return nil
+}
+
+// MarshalJSON writes the todo followed by its presentation-only fields
+func (r TodoResponse) MarshalJSON() ([]byte, error) {
+	defaultPriority(&r.Todo)
+	r.Todo.Status = currentStatus(r.Todo)
+	return json.Marshal(struct {
+		ID string `json:"id"`
+		todoJSON
+		CreatedAtLocal string `json:"created_at_local,omitempty"`
+		Changed        *bool  `json:"changed,omitempty"`
+	}{formatTodoID(r.ID), todoJSON(r.Todo), r.CreatedAtLocal, r.Changed})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBase62RoundTrip(t *testing.T) {
+	ids := []primitive.ObjectID{
+		primitive.NilObjectID,
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+	}
+	for i := 0; i < 100; i++ {
+		ids = append(ids, primitive.NewObjectID())
+	}
+
+	for _, id := range ids {
+		encoded := encodeBase62ID(id)
+		if len(encoded) != base62IDLength {
+			t.Errorf("encodeBase62ID(%s) = %q, want %d characters", id.Hex(), encoded, base62IDLength)
+		}
+		decoded, err := parseTodoID(encoded)
+		if err != nil || decoded != id {
+			t.Errorf("parseTodoID(%q) = %s, %v, want %s", encoded, decoded.Hex(), err, id.Hex())
+		}
+		if decoded, err := parseTodoID(id.Hex()); err != nil || decoded != id {
+			t.Errorf("parseTodoID(%q) = %s, %v, want %s", id.Hex(), decoded.Hex(), err, id.Hex())
+		}
+	}
+}
+
+func TestBase62KeepsOrder(t *testing.T) {
+	ids := make([]primitive.ObjectID, 50)
+	encoded := make([]string, len(ids))
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+		encoded[i] = encodeBase62ID(ids[i])
+	}
+	if !sort.StringsAreSorted(encoded) {
+		t.Error("encoded ids do not sort like the ObjectIDs")
+	}
+}
+
+func TestParseTodoIDRejectsInvalid(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"abc",
+		"zzzzzzzzzzzzzzzzzzzzzzzz", // 24 characters, not hex
+		"0000000000000000!",        // 17 characters, not base62
+		"zzzzzzzzzzzzzzzzz",        // overflows 12 bytes
+	} {
+		if _, err := parseTodoID(s); err == nil {
+			t.Errorf("parseTodoID(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestTodoJSONIDFormat(t *testing.T) {
+	id := primitive.NewObjectID()
+	todo := Todo{ID: id, Title: "Buy milk"}
+
+	for _, base62 := range []bool{false, true} {
+		base62IDs = base62
+		data, err := json.Marshal(todo)
+		base62IDs = false
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := id.Hex()
+		if base62 {
+			want = encodeBase62ID(id)
+		}
+		if !strings.Contains(string(data), `"id":"`+want+`"`) {
+			t.Errorf("base62=%v: %s, want id %s", base62, data, want)
+		}
+
+		var decoded Todo
+		if err := json.Unmarshal(data, &decoded); err != nil || decoded.ID != id {
+			t.Errorf("base62=%v: decoded id %s, %v, want %s", base62, decoded.ID.Hex(), err, id.Hex())
+		}
+	}
+}
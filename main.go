@@ -1,429 +1,1644 @@
-package main
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"log"
-	"net/http"
-	"os"
-	"time"
-
-	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-)
-
-// Todo represents a todo item
-type Todo struct {
-	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Title       string             `json:"title" bson:"title"`
-	Description string             `json:"description" bson:"description"`
-	Completed   bool               `json:"completed" bson:"completed"`
-	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
-}
-
-// TodoHandler handles todo-related HTTP requests
-type TodoHandler struct {
-	collection *mongo.Collection
-}
-
-// NewTodoHandler creates a new TodoHandler
-func NewTodoHandler(collection *mongo.Collection) *TodoHandler {
-	return &TodoHandler{
-		collection: collection,
-	}
-}
-
-// CreateTodo handles POST /todos
-func (h *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	var todo Todo
-	if err := json.NewDecoder(r.Body).Decode(&todo); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	// Validate required fields
-	if todo.Title == "" {
-		http.Error(w, "Title is required", http.StatusBadRequest)
-		return
-	}
-
-	// Check if title already exists
-	var existingTodo Todo
-	err := h.collection.FindOne(context.Background(), bson.M{"title": todo.Title}).Decode(&existingTodo)
-	if err == nil {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Todo with this title already exists",
-			"code":  "DUPLICATE_TITLE",
-		})
-		return
-	} else if err != mongo.ErrNoDocuments {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Failed to check title uniqueness",
-			"code":  "DATABASE_ERROR",
-		})
-		return
-	}
-
-	// Set timestamps
-	todo.CreatedAt = time.Now()
-	todo.UpdatedAt = time.Now()
-
-	// Insert into MongoDB
-	result, err := h.collection.InsertOne(context.Background(), todo)
-	if err != nil {
-		http.Error(w, "Failed to create todo", http.StatusInternalServerError)
-		return
-	}
-
-	// Set the ID from the insert result
-	todo.ID = result.InsertedID.(primitive.ObjectID)
-
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(todo)
-}
-
-// GetTodos handles GET /todos
-func (h *TodoHandler) GetTodos(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	cursor, err := h.collection.Find(context.Background(), bson.M{})
-	if err != nil {
-		http.Error(w, "Failed to fetch todos", http.StatusInternalServerError)
-		return
-	}
-	defer cursor.Close(context.Background())
-
-	var todos []Todo
-	if err := cursor.All(context.Background(), &todos); err != nil {
-		http.Error(w, "Failed to decode todos", http.StatusInternalServerError)
-		return
-	}
-
-	// Return empty array if no todos found
-	if todos == nil {
-		todos = []Todo{}
-	}
-
-	json.NewEncoder(w).Encode(todos)
-}
-
-// GetTodo handles GET /todos/{id}
-func (h *TodoHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	id, err := primitive.ObjectIDFromHex(vars["id"])
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Invalid todo ID",
-			"code":  "INVALID_ID",
-		})
-		return
-	}
-
-	var todo Todo
-	err = h.collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&todo)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			w.WriteHeader(http.StatusNotFound)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Todo not found",
-				"code":  "NOT_FOUND",
-			})
-		} else {
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{
-				"error": "Failed to fetch todo",
-				"code":  "DATABASE_ERROR",
-			})
-		}
-		return
-	}
-
-	json.NewEncoder(w).Encode(todo)
-}
-
-// UpdateTodo handles PUT /todos/{id}
-func (h *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	id, err := primitive.ObjectIDFromHex(vars["id"])
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Invalid todo ID",
-			"code":  "INVALID_ID",
-		})
-		return
-	}
-
-	var updateData Todo
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Invalid JSON",
-			"code":  "INVALID_JSON",
-		})
-		return
-	}
-
-	// Validate required fields
-	if updateData.Title == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Title is required",
-			"code":  "MISSING_TITLE",
-		})
-		return
-	}
-
-	// Check if title already exists (excluding current todo)
-	var existingTodo Todo
-	err = h.collection.FindOne(context.Background(), bson.M{
-		"title": updateData.Title,
-		"_id":   bson.M{"$ne": id},
-	}).Decode(&existingTodo)
-	if err == nil {
-		w.WriteHeader(http.StatusConflict)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Todo with this title already exists",
-			"code":  "DUPLICATE_TITLE",
-		})
-		return
-	} else if err != mongo.ErrNoDocuments {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Failed to check title uniqueness",
-			"code":  "DATABASE_ERROR",
-		})
-		return
-	}
-
-	// Set updated timestamp
-	updateData.UpdatedAt = time.Now()
-
-	// Create update document
-	update := bson.M{
-		"$set": bson.M{
-			"title":       updateData.Title,
-			"description": updateData.Description,
-			"completed":   updateData.Completed,
-			"updated_at":  updateData.UpdatedAt,
-		},
-	}
-
-	// Update the document
-	result, err := h.collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Failed to update todo",
-			"code":  "DATABASE_ERROR",
-		})
-		return
-	}
-
-	if result.MatchedCount == 0 {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Todo not found",
-			"code":  "NOT_FOUND",
-		})
-		return
-	}
-
-	// Fetch and return the updated todo
-	var updatedTodo Todo
-	err = h.collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&updatedTodo)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "Failed to fetch updated todo",
-			"code":  "DATABASE_ERROR",
-		})
-		return
-	}
-
-	json.NewEncoder(w).Encode(updatedTodo)
-}
-
-func (h *TodoHandler) UpdateTodoStatus(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	id, err := primitive.ObjectIDFromHex(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid todo ID", http.StatusBadRequest)
-		return
-	}
-
-	var statusUpdate struct {
-		Completed bool `json:"completed"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&statusUpdate); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	update := bson.M{
-		"$set": bson.M{
-			"completed":  statusUpdate.Completed,
-			"updated_at": time.Now(),
-		},
-	}
-
-	result, err := h.collection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
-	if err != nil {
-		http.Error(w, "Failed to update todo status", http.StatusInternalServerError)
-		return
-	}
-
-	if result.MatchedCount == 0 {
-		http.Error(w, "Todo not found", http.StatusNotFound)
-		return
-	}
-
-	var updatedTodo Todo
-	err = h.collection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&updatedTodo)
-	if err != nil {
-		http.Error(w, "Failed to fetch updated todo", http.StatusInternalServerError)
-		return
-	}
-
-	json.NewEncoder(w).Encode(updatedTodo)
-}
-
-// DeleteTodo handles DELETE /todos/{id}
-func (h *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-
-	vars := mux.Vars(r)
-	id, err := primitive.ObjectIDFromHex(vars["id"])
-	if err != nil {
-		http.Error(w, "Invalid todo ID", http.StatusBadRequest)
-		return
-	}
-
-	result, err := h.collection.DeleteOne(context.Background(), bson.M{"_id": id})
-	if err != nil {
-		http.Error(w, "Failed to delete todo", http.StatusInternalServerError)
-		return
-	}
-
-	if result.DeletedCount == 0 {
-		http.Error(w, "Todo not found", http.StatusNotFound)
-		return
-	}
-
-	w.WriteHeader(http.StatusNoContent)
-}
-
-// connectMongoDB establishes connection to MongoDB
-func connectMongoDB() (*mongo.Client, error) {
-	// Get MongoDB URI from environment variable, fallback to localhost
-	mongoURI := os.Getenv("MONGODB_URI")
-	if mongoURI == "" {
-		mongoURI = "mongodb://localhost:27017"
-	}
-
-	clientOptions := options.Client().ApplyURI(mongoURI)
-	client, err := mongo.Connect(context.Background(), clientOptions)
-	if err != nil {
-		return nil, err
-	}
-
-	// Test the connection
-	err = client.Ping(context.Background(), nil)
-	if err != nil {
-		return nil, err
-	}
-
-	fmt.Println("Connected to MongoDB!")
-	return client, nil
-}
-
-// createUniqueIndex creates a unique index on the title field
-func createUniqueIndex(collection *mongo.Collection) error {
-	indexModel := mongo.IndexModel{
-		Keys:    bson.D{{"title", 1}},
-		Options: options.Index().SetUnique(true),
-	}
-
-	_, err := collection.Indexes().CreateOne(context.Background(), indexModel)
-	if err != nil {
-		return err
-	}
-
-	fmt.Println("Created unique index on title field")
-	return nil
-}
-
-func main() {
-	// Connect to MongoDB
-	client, err := connectMongoDB()
-	if err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
-	}
-	defer client.Disconnect(context.Background())
-
-	// Get collection
-	collection := client.Database("todoapp").Collection("todos")
-
-	// Create unique index on title field
-	if err := createUniqueIndex(collection); err != nil {
-		log.Printf("Warning: Failed to create unique index: %v", err)
-	}
-
-	// Create handler
-	todoHandler := NewTodoHandler(collection)
-
-	// Setup routes
-	r := mux.NewRouter()
-
-	// Add CORS middleware first
-	r.Use(func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Access-Control-Allow-Origin", "*")
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-
-			if r.Method == "OPTIONS" {
-				w.WriteHeader(http.StatusOK)
-				return
-			}
-
-			next.ServeHTTP(w, r)
-		})
-	})
-
-	api := r.PathPrefix("/api/v1").Subrouter()
-
-	// Todo routes
-	api.HandleFunc("/todos", todoHandler.CreateTodo).Methods("POST")
-	api.HandleFunc("/todos", todoHandler.GetTodos).Methods("GET")
-	api.HandleFunc("/todos/{id}", todoHandler.GetTodo).Methods("GET")
-	api.HandleFunc("/todos/{id}", todoHandler.UpdateTodo).Methods("PUT")
-	api.HandleFunc("/todos/{id}/status", todoHandler.UpdateTodoStatus).Methods("PATCH")
-	api.HandleFunc("/todos/{id}", todoHandler.DeleteTodo).Methods("DELETE")
-
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
-	addr := ":" + port
-	fmt.Printf("Server starting on port %s\n", port)
-	log.Fatal(http.ListenAndServe(addr, r))
-}
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// Todo represents a todo item
+type Todo struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Title       string             `json:"title" bson:"title"`
+	Description string             `json:"description" bson:"description"`
+	Completed   bool               `json:"completed" bson:"completed"`
+	Status      string             `json:"status" bson:"status,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+	UserID      string             `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	HiddenUntil *time.Time         `json:"hidden_until,omitempty" bson:"hidden_until,omitempty"`
+	DeletedAt   *time.Time         `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	DueDate     *time.Time         `json:"due_date,omitempty" bson:"due_date,omitempty"`
+	Priority    string             `json:"priority" bson:"priority,omitempty"`
+	Tags        []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	Metadata    map[string]string  `json:"metadata,omitempty" bson:"metadata,omitempty"`
+	// Version increments on every update and is sent as the ETag
+	Version int `json:"version" bson:"version"`
+	// FieldUpdatedAt records when each tracked field last changed; only
+	// maintained with FIELD_TIMESTAMPS=true
+	FieldUpdatedAt map[string]time.Time `json:"field_updated_at,omitempty" bson:"field_updated_at,omitempty"`
+}
+
+// TodoResponse is a Todo with presentation-only fields added at response time
+type TodoResponse struct {
+	Todo
+	CreatedAtLocal string `json:"created_at_local,omitempty"`
+	// Changed is set by status updates to report whether anything changed
+	Changed *bool `json:"changed,omitempty"`
+}
+
+// newTodoResponse renders todo for the client, formatting created_at in loc
+// when one was requested
+func newTodoResponse(todo Todo, loc *time.Location) TodoResponse {
+	response := TodoResponse{Todo: todo}
+	if loc != nil {
+		response.CreatedAtLocal = todo.CreatedAt.In(loc).Format(time.RFC3339)
+	}
+	return response
+}
+
+// defaultLocation is used when a request does not pass ?tz=. It is loaded
+// once at startup from DEFAULT_TZ and stays nil when that is unset.
+var defaultLocation *time.Location
+
+// parseTimezone reads the optional ?tz= IANA zone name, falling back to
+// DEFAULT_TZ. A nil location means no zone was requested or configured.
+func parseTimezone(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return defaultLocation, nil
+	}
+	return time.LoadLocation(tz)
+}
+
+// decodeBody decodes the JSON request body into v. When that fails it
+// answers with writeBodyError and returns false.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeBodyError(w, err)
+		return false
+	}
+	return true
+}
+
+// writeBodyError reports a request body that did not decode: 400
+// EMPTY_BODY, INVALID_DUE_DATE or INVALID_JSON
+func writeBodyError(w http.ResponseWriter, err error) {
+	switch {
+	case err == io.EOF:
+		writeError(w, http.StatusBadRequest, CodeEmptyBody, "Request body is empty")
+	case errors.Is(err, errInvalidDueDate):
+		writeInvalidDueDate(w)
+	default:
+		writeError(w, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON")
+	}
+}
+
+// parseBoolParam reads a boolean query parameter. Only "true"/"false" and
+// "1"/"0" are accepted so every endpoint parses flags identically; a missing
+// parameter is false.
+func parseBoolParam(r *http.Request, name string) (bool, error) {
+	switch value := r.URL.Query().Get(name); value {
+	case "", "false", "0":
+		return false, nil
+	case "true", "1":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid boolean %q for %s", value, name)
+	}
+}
+
+// writeInvalidBool reports a malformed boolean query parameter
+func writeInvalidBool(w http.ResponseWriter, name string) {
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": name + " must be true or false",
+		"code":  CodeInvalidBool,
+		"param": name,
+	})
+}
+
+// writeInvalidTimezone reports an unknown ?tz= value
+func writeInvalidTimezone(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, CodeInvalidTimezone, "Invalid timezone")
+}
+
+// TodoHandler handles todo-related HTTP requests
+type TodoHandler struct {
+	collection *mongo.Collection
+	// readCollection serves GET endpoints and may use a non-primary read
+	// preference; writes and checks that must see them use collection
+	readCollection *mongo.Collection
+	// reads coalesces concurrent GetTodo lookups for the same id
+	reads singleflight.Group
+	// readEpoch is part of every reads key and moves on bulk writes
+	readEpoch atomic.Uint64
+	// descriptionTemplates enables {{placeholder}} expansion on create
+	descriptionTemplates bool
+	// titleFilter optionally rejects titles matching a content blocklist
+	titleFilter *titleFilter
+	// cache optionally serves GetTodo from memory; nil disables it
+	cache *todoCache
+	// dbTimeout bounds the database work of a single request
+	dbTimeout time.Duration
+}
+
+// NewTodoHandler creates a new TodoHandler
+func NewTodoHandler(collection *mongo.Collection) *TodoHandler {
+	return &TodoHandler{
+		collection:           collection,
+		readCollection:       collection,
+		descriptionTemplates: os.Getenv("DESCRIPTION_TEMPLATES") == "true",
+		dbTimeout:            defaultDBTimeout,
+	}
+}
+
+// defaultDBTimeout applies when DB_TIMEOUT is unset
+const defaultDBTimeout = 5 * time.Second
+
+// dbContext returns the context for a request's database calls. It ends
+// when the client disconnects or after dbTimeout, whichever comes first.
+func (h *TodoHandler) dbContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), h.dbTimeout)
+}
+
+// writeDatabaseError reports a failed database call: 503 DB_TIMEOUT when
+// the call ran out of time, 500 DATABASE_ERROR otherwise. The error is
+// logged with the request id from ctx.
+func writeDatabaseError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	requestLogger(ctx).Error(message, "error", err)
+	markDBFailure(ctx, err)
+	if errors.Is(err, context.DeadlineExceeded) || mongo.IsTimeout(err) {
+		writeError(w, http.StatusServiceUnavailable, CodeDBTimeout, "Database did not respond in time")
+		return
+	}
+
+	writeError(w, http.StatusInternalServerError, CodeDatabaseError, message)
+}
+
+// expandDescription substitutes {{title}} and {{date}} in a description.
+// Replacement is a single pass, so placeholders that appear inside the
+// substituted title are left as literal text rather than expanded again.
+func expandDescription(description, title string, now time.Time) string {
+	return strings.NewReplacer(
+		"{{title}}", title,
+		"{{date}}", now.Format("2006-01-02"),
+	).Replace(description)
+}
+
+// FieldError describes a validation failure on a single todo field
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+	Code  string `json:"code"`
+	// ExistingID points at the conflicting todo for DUPLICATE_TITLE
+	ExistingID string `json:"existing_id,omitempty"`
+}
+
+// Limits on the client-defined metadata map
+const (
+	maxMetadataKeys        = 20
+	maxMetadataKeyLength   = 64
+	maxMetadataValueLength = 256
+	maxMetadataSize        = 4096
+)
+
+// metadataKeyPattern restricts metadata keys to characters that are safe to
+// use in a Mongo field path, so they cannot smuggle in operators or nesting
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// validateMetadata checks the metadata map against the size limits
+func validateMetadata(metadata map[string]string) *FieldError {
+	if len(metadata) > maxMetadataKeys {
+		return &FieldError{
+			Field: "metadata",
+			Error: fmt.Sprintf("Metadata may have at most %d keys", maxMetadataKeys),
+			Code:  CodeInvalidMetadata,
+		}
+	}
+
+	size := 0
+	for key, value := range metadata {
+		if len(key) > maxMetadataKeyLength || !metadataKeyPattern.MatchString(key) {
+			return &FieldError{
+				Field: "metadata",
+				Error: fmt.Sprintf("Metadata key %q must be 1-%d letters, digits, '_' or '-'", key, maxMetadataKeyLength),
+				Code:  CodeInvalidMetadata,
+			}
+		}
+		if len(value) > maxMetadataValueLength {
+			return &FieldError{
+				Field: "metadata",
+				Error: fmt.Sprintf("Metadata value for %q exceeds %d characters", key, maxMetadataValueLength),
+				Code:  CodeInvalidMetadata,
+			}
+		}
+		size += len(key) + len(value)
+	}
+
+	if size > maxMetadataSize {
+		return &FieldError{
+			Field: "metadata",
+			Error: fmt.Sprintf("Metadata exceeds %d bytes in total", maxMetadataSize),
+			Code:  CodeInvalidMetadata,
+		}
+	}
+	return nil
+}
+
+// enforceUniqueTitle keeps each user's live titles unique, from
+// ENFORCE_UNIQUE_TITLE (default true). When off, neither the index nor the
+// duplicate lookup is used.
+var enforceUniqueTitle = os.Getenv("ENFORCE_UNIQUE_TITLE") != "false"
+
+// validateTodo runs the checks shared by create, update and validate.
+// excludeID skips the todo being updated in the duplicate title lookup.
+func (h *TodoHandler) validateTodo(ctx context.Context, todo Todo, excludeID primitive.ObjectID) ([]FieldError, error) {
+	fieldErrors := h.validateFields(todo)
+
+	// Only look for duplicates once the todo is otherwise valid
+	if len(fieldErrors) > 0 || !enforceUniqueTitle {
+		return fieldErrors, nil
+	}
+
+	filter := visible(ctx, bson.M{"title": todo.Title})
+	if !excludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": excludeID}
+	}
+
+	var existingTodo Todo
+	err := h.collection.FindOne(ctx, filter).Decode(&existingTodo)
+	if err == nil {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field:      "title",
+			Error:      "Todo with this title already exists",
+			Code:       CodeDuplicateTitle,
+			ExistingID: formatTodoID(existingTodo.ID),
+		})
+	} else if err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	return fieldErrors, nil
+}
+
+// validateFields runs the checks that need no database access
+func (h *TodoHandler) validateFields(todo Todo) []FieldError {
+	var fieldErrors []FieldError
+
+	if todo.Title == "" {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: "title",
+			Error: "Title is required",
+			Code:  CodeMissingTitle,
+		})
+	} else if !h.titleFilter.allows(todo.Title) {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: "title",
+			Error: "Title is not allowed",
+			Code:  CodeTitleRejected,
+		})
+	}
+
+	if todo.Status != "" && !validStatuses[todo.Status] {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: "status",
+			Error: "Status must be one of todo, in_progress, done, blocked",
+			Code:  CodeInvalidStatus,
+		})
+	}
+
+	if _, ok := priorityRanks[todo.Priority]; todo.Priority != "" && !ok {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: "priority",
+			Error: "Priority must be one of low, medium, high",
+			Code:  CodeInvalidPriority,
+		})
+	}
+
+	if fieldError := validateMetadata(todo.Metadata); fieldError != nil {
+		fieldErrors = append(fieldErrors, *fieldError)
+	}
+
+	return fieldErrors
+}
+
+// writeFieldError writes a single validation failure with the status
+// matching its code
+func writeFieldError(w http.ResponseWriter, fieldError FieldError) {
+	status := http.StatusBadRequest
+	if fieldError.Code == CodeDuplicateTitle {
+		status = http.StatusConflict
+	}
+
+	body := map[string]string{
+		"error": fieldError.Error,
+		"code":  fieldError.Code,
+	}
+	if fieldError.ExistingID != "" {
+		body["existing_id"] = fieldError.ExistingID
+	}
+
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeDuplicateTitle reports a title rejected by the unique index after it
+// passed the duplicate lookup, as happens when two requests race for it
+func writeDuplicateTitle(w http.ResponseWriter) {
+	writeFieldError(w, FieldError{
+		Field: "title",
+		Error: "Todo with this title already exists",
+		Code:  CodeDuplicateTitle,
+	})
+}
+
+// CreateTodo handles POST /todos
+func (h *TodoHandler) CreateTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	var todo Todo
+	if !decodeBody(w, r, &todo) {
+		return
+	}
+
+	// Validate fields and title uniqueness
+	fieldErrors, err := h.validateTodo(ctx, todo, primitive.NilObjectID)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to check title uniqueness")
+		return
+	}
+
+	// With ?if_absent=true or If-None-Match: * an existing todo with the same
+	// title is returned instead of a 409, so retried creates are idempotent
+	ifAbsent, err := parseBoolParam(r, "if_absent")
+	if err != nil {
+		writeInvalidBool(w, "if_absent")
+		return
+	}
+	ifAbsent = ifAbsent || r.Header.Get("If-None-Match") == "*"
+	if ifAbsent {
+		remaining := fieldErrors[:0]
+		for _, fieldError := range fieldErrors {
+			if fieldError.Code != CodeDuplicateTitle {
+				remaining = append(remaining, fieldError)
+			}
+		}
+		fieldErrors = remaining
+	}
+
+	if len(fieldErrors) > 0 {
+		writeFieldError(w, fieldErrors[0])
+		return
+	}
+
+	// Keep status and the deprecated completed flag in agreement
+	syncStatus(&todo)
+	defaultPriority(&todo)
+	todo.Tags = normalizeTags(todo.Tags)
+
+	todo.UserID = userIDFrom(ctx)
+
+	// Set timestamps
+	todo.CreatedAt = time.Now()
+	todo.UpdatedAt = time.Now()
+	todo.Version = 1
+
+	// Expand description placeholders when enabled and requested
+	if h.descriptionTemplates && r.Header.Get("X-Template-Description") == "true" {
+		todo.Description = expandDescription(todo.Description, todo.Title, todo.CreatedAt)
+	}
+
+	status := http.StatusCreated
+	if ifAbsent {
+		existing, err := h.createIfAbsent(ctx, &todo)
+		if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to create todo")
+			return
+		}
+		if existing != nil {
+			todo = *existing
+			status = http.StatusOK
+		}
+	} else {
+		// Insert into MongoDB
+		result, err := h.collection.InsertOne(ctx, todo)
+		if mongo.IsDuplicateKeyError(err) {
+			writeDuplicateTitle(w)
+			return
+		}
+		if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to create todo")
+			return
+		}
+
+		// Set the ID from the insert result
+		todo.ID = result.InsertedID.(primitive.ObjectID)
+	}
+
+	w.Header().Set("Location", "/api/v1/todos/"+formatTodoID(todo.ID))
+	w.WriteHeader(status)
+
+	// Let high-throughput clients skip the full body
+	switch r.URL.Query().Get("return") {
+	case "id":
+		json.NewEncoder(w).Encode(map[string]string{"id": formatTodoID(todo.ID)})
+	case "none":
+	default:
+		json.NewEncoder(w).Encode(todo)
+	}
+}
+
+// createIfAbsent inserts todo unless one with the same title exists, in a
+// single upsert so concurrent creates cannot both succeed. It returns the
+// existing todo, or nil after inserting.
+func (h *TodoHandler) createIfAbsent(ctx context.Context, todo *Todo) (*Todo, error) {
+	todo.ID = primitive.NewObjectID()
+
+	var existing Todo
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	err := h.collection.FindOneAndUpdate(ctx, visible(ctx, bson.M{"title": todo.Title}), bson.M{"$setOnInsert": todo}, opts).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	// A racing upsert can still lose to the unique index; the winner's todo
+	// is then the existing one
+	if mongo.IsDuplicateKeyError(err) {
+		err = h.collection.FindOne(ctx, visible(ctx, bson.M{"title": todo.Title})).Decode(&existing)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// ValidateTodo handles POST /todos/validate
+func (h *TodoHandler) ValidateTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	// A due_date that does not parse is reported with the other field
+	// errors; the rest of the todo has been decoded by then
+	var todo Todo
+	err := json.NewDecoder(r.Body).Decode(&todo)
+	invalidDueDate := errors.Is(err, errInvalidDueDate)
+	if err != nil && !invalidDueDate {
+		writeBodyError(w, err)
+		return
+	}
+
+	fieldErrors, err := h.validateTodo(ctx, todo, primitive.NilObjectID)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to check title uniqueness")
+		return
+	}
+	if invalidDueDate {
+		fieldErrors = append(fieldErrors, FieldError{
+			Field: "due_date",
+			Error: errInvalidDueDate.Error(),
+			Code:  CodeInvalidDueDate,
+		})
+	}
+
+	if len(fieldErrors) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"valid":  false,
+			"errors": fieldErrors,
+		})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]bool{"valid": true})
+}
+
+// GetTodos handles GET /todos
+func (h *TodoHandler) GetTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	loc, err := parseTimezone(r)
+	if err != nil {
+		writeInvalidTimezone(w)
+		return
+	}
+
+	includeHidden, err := parseBoolParam(r, "include_hidden")
+	if err != nil {
+		writeInvalidBool(w, "include_hidden")
+		return
+	}
+
+	// Soft-deleted todos never appear; snoozed ones stay out of the list
+	// until their hidden_until passes
+	filter := visible(ctx, bson.M{})
+	if !includeHidden {
+		filter["$or"] = bson.A{
+			bson.M{"hidden_until": nil},
+			bson.M{"hidden_until": bson.M{"$lte": time.Now()}},
+		}
+	}
+
+	// ?status= narrows the list to one workflow state
+	if status := r.URL.Query().Get("status"); status != "" {
+		if !validStatuses[status] {
+			writeError(w, http.StatusBadRequest, CodeInvalidStatus, "Status must be one of todo, in_progress, done, blocked")
+			return
+		}
+		// Compare the derived status so todos stored before statuses
+		// existed match by their completed flag
+		filter["$expr"] = bson.M{"$eq": bson.A{storedStatus, status}}
+	}
+
+	// ?completed=true|false narrows the list by completion
+	completed := false
+	if r.URL.Query().Has("completed") {
+		completed, err = parseBoolParam(r, "completed")
+		if err != nil || r.URL.Query().Get("completed") == "" {
+			writeInvalidBool(w, "completed")
+			return
+		}
+		filter["completed"] = completed
+	}
+
+	// ?overdue=true keeps incomplete todos whose due date has passed. Todos
+	// without a due date are never overdue.
+	overdue, err := parseBoolParam(r, "overdue")
+	if err != nil {
+		writeInvalidBool(w, "overdue")
+		return
+	}
+	if overdue && completed {
+		writeError(w, http.StatusBadRequest, CodeConflictingFilters, "overdue=true only matches incomplete todos and cannot be combined with completed=true")
+		return
+	}
+	if overdue {
+		filter["completed"] = false
+		filter["due_date"] = bson.M{"$lt": time.Now()}
+	}
+
+	// ?tag= matches todos carrying that tag; repeating it requires all of them
+	if tags := normalizeTags(r.URL.Query()["tag"]); len(tags) == 1 {
+		filter["tags"] = tags[0]
+	} else if len(tags) > 1 {
+		filter["tags"] = bson.M{"$all": tags}
+	}
+
+	// ?q= is a case-insensitive substring search over title and description.
+	// It sits under $and because the hidden filter already uses $or.
+	if q := r.URL.Query().Get("q"); q != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(q), Options: "i"}
+		filter["$and"] = bson.A{bson.M{"$or": bson.A{
+			bson.M{"title": pattern},
+			bson.M{"description": pattern},
+		}}}
+	}
+
+	// ?meta.<key>=<value> matches todos whose metadata has that exact value
+	for param, values := range r.URL.Query() {
+		key, ok := strings.CutPrefix(param, "meta.")
+		if !ok {
+			continue
+		}
+		if !metadataKeyPattern.MatchString(key) {
+			writeError(w, http.StatusBadRequest, CodeInvalidMetadataKey, "Invalid metadata key")
+			return
+		}
+		filter["metadata."+key] = values[0]
+	}
+
+	page, fieldError := parsePage(r)
+	if fieldError != nil {
+		writeFieldError(w, *fieldError)
+		return
+	}
+
+	// Let clients skip re-downloading an unchanged view
+	etag, err := h.listETag(ctx, r, filter)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to fetch todos")
+		return
+	}
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	total, err := h.readCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to count todos")
+		return
+	}
+
+	cursor, err := page.find(ctx, h.readCollection, filter)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to fetch todos")
+		return
+	}
+	defer cursor.Close(ctx)
+
+	var todos []Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to decode todos")
+		return
+	}
+
+	// Always return an array, even if no todos were found
+	responses := make([]TodoResponse, 0, len(todos))
+	for _, todo := range todos {
+		responses = append(responses, newTodoResponse(todo, loc))
+	}
+
+	json.NewEncoder(w).Encode(TodoPage{
+		Data:  responses,
+		Page:  page.Page,
+		Limit: page.Limit,
+		Total: total,
+	})
+}
+
+// GetTodo handles GET /todos/{id}
+func (h *TodoHandler) GetTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	loc, err := parseTimezone(r)
+	if err != nil {
+		writeInvalidTimezone(w)
+		return
+	}
+
+	// Cache-Control: no-cache skips the cache and refreshes the entry
+	if !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+		if todo, ok := h.cache.get(id); ok && ownsTodo(r.Context(), todo) {
+			w.Header().Set("ETag", versionETag(todo.Version))
+			json.NewEncoder(w).Encode(newTodoResponse(todo, loc))
+			return
+		}
+	}
+
+	// Concurrent requests for the same id share a single database read. The
+	// lookup is not cancelled with any one request so a client disconnecting
+	// does not fail the others waiting on it; it keeps the first caller's
+	// context values for logging and the breaker. It is shared across users
+	// too, so ownership is checked on the result.
+	result, err, _ := h.reads.Do(h.readKey(id), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), h.dbTimeout)
+		defer cancel()
+
+		// With the cache on, read from the primary: a lagging secondary's
+		// copy would otherwise be cached for the whole TTL after a write
+		source := h.readCollection
+		if h.cache != nil {
+			source = h.collection
+		}
+
+		gen := h.cache.generation()
+		var todo Todo
+		err := source.FindOne(ctx, notDeleted(bson.M{"_id": id})).Decode(&todo)
+		if err == nil {
+			h.cache.add(todo, gen)
+		}
+		return todo, err
+	})
+	if err == nil && !ownsTodo(r.Context(), result.(Todo)) {
+		err = mongo.ErrNoDocuments
+	}
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+		} else {
+			writeDatabaseError(r.Context(), w, err, "Failed to fetch todo")
+		}
+		return
+	}
+
+	todo := result.(Todo)
+	w.Header().Set("ETag", versionETag(todo.Version))
+	json.NewEncoder(w).Encode(newTodoResponse(todo, loc))
+}
+
+// UpdateTodo handles PUT /todos/{id}
+func (h *TodoHandler) UpdateTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	expectedVersion, conditional, err := parseIfMatch(r)
+	if err != nil {
+		writeInvalidIfMatch(w)
+		return
+	}
+
+	var updateData Todo
+	if !decodeBody(w, r, &updateData) {
+		return
+	}
+
+	// Validate fields and title uniqueness (excluding current todo)
+	fieldErrors, err := h.validateTodo(ctx, updateData, id)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to check title uniqueness")
+		return
+	}
+	if len(fieldErrors) > 0 {
+		writeFieldError(w, fieldErrors[0])
+		return
+	}
+
+	// Keep status and the deprecated completed flag in agreement
+	syncStatus(&updateData)
+	defaultPriority(&updateData)
+	updateData.Tags = normalizeTags(updateData.Tags)
+
+	// Set updated timestamp
+	updateData.UpdatedAt = time.Now()
+
+	// Create update document
+	update := setUpdate(bson.M{
+		"title":       updateData.Title,
+		"description": updateData.Description,
+		"completed":   updateData.Completed,
+		"status":      updateData.Status,
+		"metadata":    updateData.Metadata,
+		"due_date":    updateData.DueDate,
+		"priority":    updateData.Priority,
+		"tags":        updateData.Tags,
+		"updated_at":  updateData.UpdatedAt,
+	}, updateData.UpdatedAt)
+
+	// With ?return=both or ?return=changes the document is captured before
+	// the update so it can be compared with the new values
+	returnMode := r.URL.Query().Get("return")
+	needPrevious := returnMode == "both" || returnMode == "changes"
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	if needPrevious {
+		opts.SetReturnDocument(options.Before)
+	}
+
+	// If-Match makes the update conditional on the version the client saw,
+	// and the workflow rules apply to the status it sets
+	filter := visible(ctx, bson.M{"_id": id})
+	if conditional {
+		matchVersion(filter, expectedVersion)
+	}
+	next := toStatus(updateData.Status)
+	guardTransition(filter, next)
+
+	// Update the document and fetch it in the same round-trip
+	var updatedTodo Todo
+	err = h.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedTodo)
+	h.invalidate(id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			h.writeRejectedUpdate(ctx, w, id, expectedVersion, conditional, next)
+		} else if mongo.IsDuplicateKeyError(err) {
+			writeDuplicateTitle(w)
+		} else {
+			writeDatabaseError(ctx, w, err, "Failed to update todo")
+		}
+		return
+	}
+
+	if needPrevious {
+		previousTodo := updatedTodo
+		updatedTodo.Title = updateData.Title
+		updatedTodo.Description = updateData.Description
+		updatedTodo.Completed = updateData.Completed
+		updatedTodo.Status = updateData.Status
+		updatedTodo.Metadata = updateData.Metadata
+		updatedTodo.DueDate = updateData.DueDate
+		updatedTodo.Priority = updateData.Priority
+		updatedTodo.Tags = updateData.Tags
+		updatedTodo.UpdatedAt = updateData.UpdatedAt
+		updatedTodo.Version = previousTodo.Version + 1
+		stampChangedFields(previousTodo, &updatedTodo, updateData.UpdatedAt)
+		w.Header().Set("ETag", versionETag(updatedTodo.Version))
+
+		if returnMode == "changes" {
+			changes, err := changedFields(previousTodo, updatedTodo)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, CodeInternalError, "Failed to compute changes")
+				return
+			}
+			json.NewEncoder(w).Encode(changes)
+			return
+		}
+
+		json.NewEncoder(w).Encode(map[string]Todo{
+			"previous": previousTodo,
+			"current":  updatedTodo,
+		})
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(updatedTodo.Version))
+	json.NewEncoder(w).Encode(updatedTodo)
+}
+
+func (h *TodoHandler) UpdateTodoStatus(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	var statusUpdate struct {
+		Completed bool `json:"completed"`
+	}
+
+	if !decodeBody(w, r, &statusUpdate) {
+		return
+	}
+
+	// Only touch the document when the status actually changes. Doing the
+	// comparison in a pipeline update keeps it atomic, so rapid double toggles
+	// cannot both be treated as a change.
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"updated_at": bson.M{"$cond": bson.A{
+				bson.M{"$ne": bson.A{"$completed", statusUpdate.Completed}},
+				now,
+				"$updated_at",
+			}},
+			"version": bson.M{"$cond": bson.A{
+				bson.M{"$ne": bson.A{"$completed", statusUpdate.Completed}},
+				bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+				"$version",
+			}},
+			"completed": statusUpdate.Completed,
+			"status":    statusForCompleted(statusUpdate.Completed),
+		}}},
+	}
+
+	if fieldTimestamps {
+		update = withFieldTimestamps(update, now)
+	}
+
+	// Completing or reopening is a workflow transition like any other
+	filter := visible(ctx, bson.M{"_id": id})
+	next := forCompleted(statusUpdate.Completed)
+	guardTransition(filter, next)
+
+	var previousTodo Todo
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	err = h.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previousTodo)
+	h.invalidate(id)
+	if err == mongo.ErrNoDocuments {
+		h.writeRejectedUpdate(ctx, w, id, 0, false, next)
+		return
+	} else if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to update todo status")
+		return
+	}
+
+	updatedTodo := previousTodo
+	changed := previousTodo.Completed != statusUpdate.Completed
+	if changed {
+		updatedTodo.Completed = statusUpdate.Completed
+		updatedTodo.UpdatedAt = now
+		updatedTodo.Version = previousTodo.Version + 1
+		if statusUpdate.Completed {
+			updatedTodo.Status = StatusDone
+		} else if currentStatus(previousTodo) == StatusDone {
+			updatedTodo.Status = StatusTodo
+		}
+		stampChangedFields(previousTodo, &updatedTodo, now)
+	}
+
+	response := newTodoResponse(updatedTodo, nil)
+	response.Changed = &changed
+	json.NewEncoder(w).Encode(response)
+}
+
+// SnoozeTodo handles PATCH /todos/{id}/snooze. It hides the todo from the
+// list until hidden_until; a null hidden_until makes it visible again.
+func (h *TodoHandler) SnoozeTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	var snooze struct {
+		HiddenUntil *time.Time `json:"hidden_until"`
+	}
+	if !decodeBody(w, r, &snooze) {
+		return
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"updated_at": now}, "$inc": bson.M{"version": 1}}
+	if snooze.HiddenUntil != nil {
+		if !snooze.HiddenUntil.After(now) {
+			writeError(w, http.StatusBadRequest, CodeInvalidHiddenUntil, "hidden_until must be in the future")
+			return
+		}
+		update["$set"].(bson.M)["hidden_until"] = *snooze.HiddenUntil
+	} else {
+		update["$unset"] = bson.M{"hidden_until": ""}
+	}
+
+	var updatedTodo Todo
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.collection.FindOneAndUpdate(ctx, visible(ctx, bson.M{"_id": id}), update, opts).Decode(&updatedTodo)
+	h.invalidate(id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+		} else {
+			writeDatabaseError(ctx, w, err, "Failed to snooze todo")
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedTodo)
+}
+
+// DeleteCompletedTodos handles DELETE /todos/completed. With
+// ?before=<RFC3339> only todos last updated before that time are removed, so
+// recently finished ones can be kept. Like DeleteTodo it soft deletes unless
+// ?hard=true, which also purges completed todos already soft deleted.
+func (h *TodoHandler) DeleteCompletedTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	hard, err := parseBoolParam(r, "hard")
+	if err != nil {
+		writeInvalidBool(w, "hard")
+		return
+	}
+	filter := ownedBy(ctx, bson.M{"completed": true})
+	if !hard {
+		notDeleted(filter)
+	}
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		before, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, CodeInvalidBefore, "before must be an RFC3339 timestamp")
+			return
+		}
+		filter["updated_at"] = bson.M{"$lt": before}
+	}
+
+	var deleted int64
+	if hard {
+		var result *mongo.DeleteResult
+		result, err = h.collection.DeleteMany(ctx, filter)
+		if err == nil {
+			deleted = result.DeletedCount
+		}
+	} else {
+		var result *mongo.UpdateResult
+		update := bson.M{"$set": bson.M{"deleted_at": time.Now()}, "$inc": bson.M{"version": 1}}
+		result, err = h.collection.UpdateMany(ctx, filter, update)
+		if err == nil {
+			deleted = result.ModifiedCount
+		}
+	}
+	h.invalidateAll()
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to delete completed todos")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int64{"deleted": deleted})
+}
+
+// DeleteTodo handles DELETE /todos/{id}
+func (h *TodoHandler) DeleteTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	// If-Match carries the ETag the client last saw; only delete the todo
+	// if it has not changed since
+	expectedVersion, conditional, err := parseIfMatch(r)
+	if err != nil {
+		writeInvalidIfMatch(w)
+		return
+	}
+	// ?hard=true removes the document for good, including one that was
+	// already soft deleted. Otherwise it is only marked deleted so that
+	// POST /todos/{id}/restore can bring it back.
+	hard, err := parseBoolParam(r, "hard")
+	if err != nil {
+		writeInvalidBool(w, "hard")
+		return
+	}
+	existing := ownedBy(ctx, bson.M{"_id": id})
+	filter := ownedBy(ctx, bson.M{"_id": id})
+	if !hard {
+		notDeleted(existing)
+		notDeleted(filter)
+	}
+	if conditional {
+		matchVersion(filter, expectedVersion)
+	}
+
+	var matched int64
+	if hard {
+		var result *mongo.DeleteResult
+		result, err = h.collection.DeleteOne(ctx, filter)
+		if err == nil {
+			matched = result.DeletedCount
+		}
+	} else {
+		var result *mongo.UpdateResult
+		update := bson.M{"$set": bson.M{"deleted_at": time.Now()}, "$inc": bson.M{"version": 1}}
+		result, err = h.collection.UpdateOne(ctx, filter, update)
+		if err == nil {
+			matched = result.MatchedCount
+		}
+	}
+	h.invalidate(id)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to delete todo")
+		return
+	}
+
+	if matched == 0 {
+		if conditional {
+			// Tell a stale delete apart from a missing todo
+			count, err := h.collection.CountDocuments(ctx, existing)
+			if err != nil {
+				writeDatabaseError(ctx, w, err, "Failed to delete todo")
+				return
+			}
+			if count > 0 {
+				writeError(w, http.StatusPreconditionFailed, CodeStaleDelete, "Todo has changed since it was last fetched")
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResetTodos handles POST /admin/reset. It deletes every todo and is only
+// available when the server runs with ENV=test.
+func (h *TodoHandler) ResetTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	if os.Getenv("ENV") != "test" {
+		writeError(w, http.StatusForbidden, CodeForbidden, "Reset is only available when ENV=test")
+		return
+	}
+
+	result, err := h.collection.DeleteMany(ctx, bson.M{})
+	h.invalidateAll()
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to reset todos")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int64{"deleted": result.DeletedCount})
+}
+
+// BackfillCreatedAt handles POST /admin/backfill-created-at. Legacy documents
+// without timestamps get them from the creation time embedded in their
+// ObjectID so they sort correctly alongside newer todos.
+func (h *TodoHandler) BackfillCreatedAt(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"created_at": nil},
+		bson.M{"updated_at": nil},
+	}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"created_at": bson.M{"$ifNull": bson.A{"$created_at", bson.M{"$toDate": "$_id"}}},
+			"updated_at": bson.M{"$ifNull": bson.A{"$updated_at", bson.M{"$toDate": "$_id"}}},
+		}}},
+	}
+
+	result, err := h.collection.UpdateMany(ctx, filter, update)
+	h.invalidateAll()
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to backfill timestamps")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]int64{"updated": result.ModifiedCount})
+}
+
+// mongoURIFromEnv returns MONGODB_URI when set. Otherwise it assembles a
+// connection string from the discrete MONGO_* variables, falling back to
+// localhost when none of them are set either.
+func mongoURIFromEnv() (string, error) {
+	if uri := os.Getenv("MONGODB_URI"); uri != "" {
+		return uri, nil
+	}
+
+	host := os.Getenv("MONGO_HOST")
+	port := os.Getenv("MONGO_PORT")
+	user := os.Getenv("MONGO_USER")
+	password := os.Getenv("MONGO_PASSWORD")
+	authSource := os.Getenv("MONGO_AUTH_SOURCE")
+	useTLS := os.Getenv("MONGO_TLS")
+
+	if host == "" && port == "" && user == "" && password == "" && authSource == "" && useTLS == "" {
+		return "mongodb://localhost:27017", nil
+	}
+
+	if host == "" {
+		return "", fmt.Errorf("MONGO_HOST is required when MONGODB_URI is not set")
+	}
+	if port == "" {
+		port = "27017"
+	} else if _, err := strconv.Atoi(port); err != nil {
+		return "", fmt.Errorf("MONGO_PORT must be a number, got %q", port)
+	}
+	if (user == "") != (password == "") {
+		return "", fmt.Errorf("MONGO_USER and MONGO_PASSWORD must be set together")
+	}
+
+	uri := url.URL{
+		Scheme: "mongodb",
+		Host:   net.JoinHostPort(host, port),
+		Path:   "/",
+	}
+	// url.UserPassword escapes reserved characters in the credentials
+	if user != "" {
+		uri.User = url.UserPassword(user, password)
+	}
+
+	// Without authSource the driver authenticates against admin
+	query := url.Values{}
+	if authSource != "" {
+		query.Set("authSource", authSource)
+	}
+	if useTLS != "" {
+		enabled, err := strconv.ParseBool(useTLS)
+		if err != nil {
+			return "", fmt.Errorf("MONGO_TLS must be true or false, got %q", useTLS)
+		}
+		query.Set("tls", strconv.FormatBool(enabled))
+	}
+	uri.RawQuery = query.Encode()
+
+	return uri.String(), nil
+}
+
+// mongoDatabaseFromEnv returns the database holding the todos collection,
+// MONGO_DB or todoapp by default
+func mongoDatabaseFromEnv() string {
+	if database := os.Getenv("MONGO_DB"); database != "" {
+		return database
+	}
+	return "todoapp"
+}
+
+// connectMongoDB establishes connection to MongoDB
+func connectMongoDB(tracerProvider trace.TracerProvider) (*mongo.Client, error) {
+	mongoURI, err := mongoURIFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	// Every command gets a client span, and successes also reach the
+	// breaker of the request that issued them
+	monitor := otelmongo.NewMonitor(otelmongo.WithTracerProvider(tracerProvider))
+	traceSucceeded := monitor.Succeeded
+	monitor.Succeeded = func(ctx context.Context, evt *event.CommandSucceededEvent) {
+		traceSucceeded(ctx, evt)
+		breakerMonitor.Succeeded(ctx, evt)
+	}
+	clientOptions := options.Client().ApplyURI(mongoURI).SetMonitor(monitor)
+	client, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Test the connection
+	err = client.Ping(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("Connected to MongoDB!")
+	return client, nil
+}
+
+// uniqueTitleIndex is the name MongoDB gives the index createUniqueIndex
+// builds
+const uniqueTitleIndex = "user_id_1_title_1_deleted_at_1"
+
+// createUniqueIndex makes titles unique per user among todos that are not
+// soft deleted. The index covers user_id, title and deleted_at: a user's
+// live todos all index deleted_at as null and so collide on title, while
+// each deleted todo keeps its own deletion time out of the way. Todos
+// without a user_id share one scope. Indexes from before per-user titles
+// are dropped, since they would still block reusing a title.
+func createUniqueIndex(collection *mongo.Collection) error {
+	if err := dropIndexes(collection, "title_1", "title_1_deleted_at_1"); err != nil {
+		return err
+	}
+
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "title", Value: 1}, {Key: "deleted_at", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	}
+
+	_, err := collection.Indexes().CreateOne(context.Background(), indexModel)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Created unique index on user_id, title and deleted_at")
+	return nil
+}
+
+// dropUniqueIndex removes the index createUniqueIndex builds, so repeated
+// titles are accepted once ENFORCE_UNIQUE_TITLE is turned off
+func dropUniqueIndex(collection *mongo.Collection) error {
+	return dropIndexes(collection, uniqueTitleIndex)
+}
+
+// dropIndexes drops the named indexes, skipping any that do not exist
+func dropIndexes(collection *mongo.Collection, names ...string) error {
+	for _, name := range names {
+		_, err := collection.Indexes().DropOne(context.Background(), name)
+		var cmdErr mongo.CommandError
+		// 26 NamespaceNotFound and 27 IndexNotFound mean there is nothing to drop
+		if err != nil && !(errors.As(err, &cmdErr) && (cmdErr.Code == 26 || cmdErr.Code == 27)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// jitteredRetryAfter returns a Retry-After value in whole seconds: base plus
+// a random share of jitter, so rejected clients do not all retry in step
+func jitteredRetryAfter(base, jitter time.Duration) int {
+	delay := base
+	if jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(jitter) + 1))
+	}
+
+	seconds := int((delay + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// limitConcurrency bounds the number of API requests, and with them MongoDB
+// operations, running at once. A request waits up to queueTimeout for a free
+// slot before being rejected with 503 OVERLOADED and a Retry-After of
+// retryBase plus up to retryJitter.
+func limitConcurrency(max int, queueTimeout, retryBase, retryJitter time.Duration) mux.MiddlewareFunc {
+	slots := make(chan struct{}, max)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			timer := time.NewTimer(queueTimeout)
+			defer timer.Stop()
+
+			select {
+			case slots <- struct{}{}:
+			case <-timer.C:
+				w.Header().Set("Retry-After", strconv.Itoa(jitteredRetryAfter(retryBase, retryJitter)))
+				writeError(w, http.StatusServiceUnavailable, CodeOverloaded, "Server is overloaded, try again later")
+				return
+			case <-r.Context().Done():
+				return
+			}
+			defer func() { <-slots }()
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func main() {
+	// Log as JSON; the standard log package is routed through the same handler
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+
+	// Load the server-wide default timezone
+	if tz := os.Getenv("DEFAULT_TZ"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			log.Fatal("Invalid DEFAULT_TZ:", err)
+		}
+		defaultLocation = loc
+	}
+
+	// Trace requests and MongoDB commands when an OTLP endpoint is configured
+	tracerProvider, shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Connect to MongoDB
+	client, err := connectMongoDB(tracerProvider)
+	if err != nil {
+		log.Fatal("Failed to connect to MongoDB:", err)
+	}
+
+	// Get collection
+	collection := client.Database(mongoDatabaseFromEnv()).Collection("todos")
+
+	// Create the unique index on each user's titles, or drop it when
+	// repeated titles are allowed
+	if enforceUniqueTitle {
+		if err := createUniqueIndex(collection); err != nil {
+			log.Printf("Warning: Failed to create unique index: %v", err)
+		}
+	} else if err := dropUniqueIndex(collection); err != nil {
+		log.Printf("Warning: Failed to drop unique index: %v", err)
+	}
+
+	// Create handler
+	todoHandler := NewTodoHandler(collection)
+
+	// Bound each request's database work
+	if raw := os.Getenv("DB_TIMEOUT"); raw != "" {
+		timeout, err := time.ParseDuration(raw)
+		if err != nil || timeout <= 0 {
+			log.Fatal("Invalid DB_TIMEOUT:", raw)
+		}
+		todoHandler.dbTimeout = timeout
+	}
+
+	// Serve GET endpoints with the configured read preference
+	if mode := os.Getenv("READ_PREFERENCE"); mode != "" {
+		readMode, err := readpref.ModeFromString(mode)
+		if err != nil {
+			log.Fatal("Invalid READ_PREFERENCE:", err)
+		}
+		readPref, err := readpref.New(readMode)
+		if err != nil {
+			log.Fatal("Invalid READ_PREFERENCE:", err)
+		}
+		todoHandler.readCollection, err = collection.Clone(options.Collection().SetReadPreference(readPref))
+		if err != nil {
+			log.Fatal("Failed to apply READ_PREFERENCE:", err)
+		}
+	}
+
+	// Load custom workflow transition rules
+	if err := loadWorkflowTransitions(); err != nil {
+		log.Fatal("Invalid WORKFLOW_TRANSITIONS:", err)
+	}
+
+	// Load the optional title blocklist
+	todoHandler.titleFilter, err = loadTitleFilter(os.Getenv("TITLE_BLOCKLIST_FILE"))
+	if err != nil {
+		log.Fatal("Failed to load title blocklist:", err)
+	}
+
+	// Cache single-todo reads when TODO_CACHE_SIZE is set
+	if cacheSize, err := strconv.Atoi(os.Getenv("TODO_CACHE_SIZE")); err == nil && cacheSize > 0 {
+		cacheTTL := 30 * time.Second
+		if raw := os.Getenv("TODO_CACHE_TTL"); raw != "" {
+			cacheTTL, err = time.ParseDuration(raw)
+			if err != nil || cacheTTL <= 0 {
+				log.Fatal("Invalid TODO_CACHE_TTL:", raw)
+			}
+		}
+		todoHandler.cache = newTodoCache(cacheSize, cacheTTL)
+	}
+
+	// Setup routes
+	r := mux.NewRouter()
+
+	// Add CORS middleware
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// Start a span per request, continuing the caller's trace
+	r.Use(tracingMiddleware(tracerProvider))
+
+	// Unknown routes and methods get the same JSON errors as the API
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, CodeNotFound, "Route not found")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	})
+
+	// Status page for quick ops checks
+	statusHandler := NewStatusHandler(client, collection)
+	r.HandleFunc("/", statusHandler.ServeStatus).Methods("GET")
+
+	// Probes for container orchestration, outside /api/v1 so the breaker and
+	// limiters never affect them
+	r.HandleFunc("/healthz", statusHandler.Healthz).Methods("GET")
+	r.HandleFunc("/readyz", statusHandler.Readyz).Methods("GET")
+
+	api := r.PathPrefix("/api/v1").Subrouter()
+
+	// Inject latency and failures for resilience testing when CHAOS=true
+	if chaos := loadChaosConfig(); chaos != nil {
+		log.Printf("Warning: chaos mode enabled, injecting latency and errors")
+		api.Use(chaosMiddleware(chaos))
+	}
+
+	// Fail fast while MongoDB is down; DB_BREAKER_THRESHOLD=0 disables it
+	breakerThreshold := 5
+	if v, err := strconv.Atoi(os.Getenv("DB_BREAKER_THRESHOLD")); err == nil {
+		breakerThreshold = v
+	}
+	if breakerThreshold > 0 {
+		api.Use(newCircuitBreaker(breakerThreshold, 5*time.Second, time.Minute).middleware)
+	}
+
+	// Bound concurrent database work when MAX_CONCURRENT_DB_OPS is set
+	if maxOps, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_DB_OPS")); err == nil && maxOps > 0 {
+		retryBase, retryJitter := time.Second, 2*time.Second
+		if seconds, err := strconv.Atoi(os.Getenv("OVERLOAD_RETRY_AFTER")); err == nil && seconds > 0 {
+			retryBase = time.Duration(seconds) * time.Second
+		}
+		if seconds, err := strconv.Atoi(os.Getenv("OVERLOAD_RETRY_JITTER")); err == nil && seconds >= 0 {
+			retryJitter = time.Duration(seconds) * time.Second
+		}
+		api.Use(limitConcurrency(maxOps, 100*time.Millisecond, retryBase, retryJitter))
+	}
+
+	// Todo and tag routes are scoped to the user named by the bearer token
+	// when JWT_SECRET is set. Admin routes keep their own checks.
+	todos := api.NewRoute().Subrouter()
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		todos.Use(requireUser([]byte(secret)))
+	} else {
+		log.Printf("Warning: JWT_SECRET is not set, todos are shared by all clients")
+	}
+
+	// Todo routes
+	todos.HandleFunc("/todos", todoHandler.CreateTodo).Methods("POST")
+	todos.HandleFunc("/todos/validate", todoHandler.ValidateTodo).Methods("POST")
+	todos.HandleFunc("/todos/merge", todoHandler.MergeTodos).Methods("POST")
+	todos.HandleFunc("/todos/bulk", todoHandler.BulkCreateTodos).Methods("POST")
+	todos.HandleFunc("/todos/sync", todoHandler.SyncTodos).Methods("POST")
+	todos.HandleFunc("/todos", todoHandler.GetTodos).Methods("GET")
+	todos.HandleFunc("/todos/export.csv", todoHandler.ExportTodosCSV).Methods("GET")
+	todos.HandleFunc("/todos/diff", todoHandler.DiffTodos).Methods("GET")
+	todos.HandleFunc("/todos/duplicates", todoHandler.FindDuplicateTodos).Methods("GET")
+	todos.HandleFunc("/todos/stats/prometheus", todoHandler.PrometheusStats).Methods("GET")
+	todos.HandleFunc("/todos/{id}", todoHandler.GetTodo).Methods("GET")
+	todos.HandleFunc("/todos/{id}", todoHandler.UpdateTodo).Methods("PUT")
+	todos.HandleFunc("/todos/{id}", todoHandler.PatchTodo).Methods("PATCH")
+	todos.HandleFunc("/todos/{id}/status", todoHandler.UpdateTodoStatus).Methods("PATCH")
+	todos.HandleFunc("/todos/{id}/snooze", todoHandler.SnoozeTodo).Methods("PATCH")
+	todos.HandleFunc("/todos/{id}/restore", todoHandler.RestoreTodo).Methods("POST")
+	todos.HandleFunc("/todos/{id}/workflow", todoHandler.TransitionTodo).Methods("PATCH")
+	// Registered before /todos/{id} so "completed" is not taken for an id
+	todos.HandleFunc("/todos/completed", todoHandler.DeleteCompletedTodos).Methods("DELETE")
+	todos.HandleFunc("/todos/{id}", todoHandler.DeleteTodo).Methods("DELETE")
+
+	// Tag routes
+	todos.HandleFunc("/tags", todoHandler.ListTags).Methods("GET")
+
+	// Admin routes
+	api.HandleFunc("/admin/reset", todoHandler.ResetTodos).Methods("POST")
+	api.Handle("/admin/backfill-created-at", requireAdmin(http.HandlerFunc(todoHandler.BackfillCreatedAt))).Methods("POST")
+	api.Handle("/admin/snapshot", requireAdmin(http.HandlerFunc(todoHandler.SnapshotTodos))).Methods("GET")
+	api.Handle("/admin/restore", requireAdmin(http.HandlerFunc(todoHandler.RestoreTodos))).Methods("POST")
+
+	// Start server
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	addr := ":" + port
+
+	// Tag every request with an id and write one access log line for it.
+	// Wrapping the router rather than using r.Use also logs the 404 and 405
+	// answers mux gives when no route matches.
+	server := &http.Server{Addr: addr, Handler: logRequests(r)}
+
+	// Serve HTTPS when a certificate is configured. FORCE_HTTPS adds HSTS and
+	// a plain-HTTP listener that only redirects; without TLS it does nothing.
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	useTLS := certFile != "" && keyFile != ""
+	var redirectServer *http.Server
+	if useTLS && os.Getenv("FORCE_HTTPS") == "true" {
+		server.Handler = logRequests(hsts(r))
+
+		redirectPort := os.Getenv("HTTP_REDIRECT_PORT")
+		if redirectPort == "" {
+			redirectPort = "80"
+		}
+		redirectServer = &http.Server{Addr: ":" + redirectPort, Handler: redirectToHTTPS(port)}
+		go func() {
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal("Redirect server failed:", err)
+			}
+		}()
+		fmt.Printf("Redirecting HTTP on port %s to HTTPS\n", redirectPort)
+	}
+
+	go func() {
+		var err error
+		if useTLS {
+			fmt.Printf("Server starting with TLS on port %s\n", port)
+			err = server.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			fmt.Printf("Server starting on port %s\n", port)
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Server failed:", err)
+		}
+	}()
+
+	// Wait for SIGINT or SIGTERM, then let in-flight requests finish
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+
+	log.Printf("Received %v, shutting down", sig)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Shutdown did not complete cleanly: %v", err)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+
+	// Disconnect with a fresh deadline so it still runs when draining timed
+	// out
+	log.Println("Disconnecting from MongoDB")
+	disconnectCtx, cancelDisconnect := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelDisconnect()
+	if err := client.Disconnect(disconnectCtx); err != nil {
+		log.Printf("Failed to disconnect from MongoDB: %v", err)
+	}
+	log.Println("Shutdown complete")
+}
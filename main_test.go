@@ -0,0 +1,796 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// todoRequest builds a request for a /todos/{id} route with the mux
+// variable already set, as the router would
+func todoRequest(method string, id primitive.ObjectID) *http.Request {
+	r := httptest.NewRequest(method, "/api/v1/todos/"+id.Hex(), nil)
+	return mux.SetURLVars(r, map[string]string{"id": id.Hex()})
+}
+
+func TestGetTodoCoalescesConcurrentReads(t *testing.T) {
+	// Hold the find open long enough for every request to join it
+	var finds atomic.Int32
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName == "find" {
+				finds.Add(1)
+				time.Sleep(100 * time.Millisecond)
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("concurrent", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		// Only one response is queued; a second find would fail
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}}))
+		h := NewTodoHandler(mt.Coll)
+
+		const requests = 10
+		codes := make([]int, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				rec := httptest.NewRecorder()
+				h.GetTodo(rec, todoRequest(http.MethodGet, id))
+				codes[i] = rec.Code
+			}(i)
+		}
+		wg.Wait()
+
+		for i, code := range codes {
+			if code != http.StatusOK {
+				t.Errorf("request %d: status = %d, want 200", i, code)
+			}
+		}
+		if n := finds.Load(); n != 1 {
+			t.Errorf("find ran %d times, want 1", n)
+		}
+	})
+}
+
+func TestLimitConcurrencySaturation(t *testing.T) {
+	release := make(chan struct{})
+	entered := make(chan struct{}, 2)
+	handler := limitConcurrency(1, 50*time.Millisecond, time.Second, 0)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil))
+		return rec
+	}
+
+	// The first request takes the only slot and holds it
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- serve() }()
+	<-entered
+
+	// A second request waits out the queue timeout and is turned away
+	rec := serve()
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("saturated: status = %d, want 503", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), CodeOverloaded) {
+		t.Errorf("saturated: body = %s, want code OVERLOADED", rec.Body)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("saturated: Retry-After = %q, want 1", got)
+	}
+
+	// A request queued while the slot is busy gets it once it frees up
+	go func() { done <- serve() }()
+	time.Sleep(10 * time.Millisecond)
+	release <- struct{}{}
+	<-entered
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if rec := <-done; rec.Code != http.StatusOK {
+			t.Errorf("after release: status = %d, want 200", rec.Code)
+		}
+	}
+}
+
+func TestUpdateTodoStatusConcurrentDoubleToggle(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("double toggle", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		// The server applies the two updates one after the other, so the
+		// second sees the document the first already completed
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}, {Key: "completed", Value: false}}}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}, {Key: "completed", Value: true}}}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		const requests = 2
+		changed := make([]bool, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				r := todoRequest(http.MethodPatch, id)
+				r.Body = io.NopCloser(strings.NewReader(`{"completed":true}`))
+				rec := httptest.NewRecorder()
+				h.UpdateTodoStatus(rec, r)
+				if rec.Code != http.StatusOK {
+					t.Errorf("request %d: status = %d, want 200", i, rec.Code)
+					return
+				}
+				var body struct {
+					Changed bool `json:"changed"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Errorf("request %d: decoding body: %v", i, err)
+				}
+				changed[i] = body.Changed
+			}(i)
+		}
+		wg.Wait()
+
+		if changed[0] == changed[1] {
+			t.Errorf("changed = %v, want true for exactly one request", changed)
+		}
+	})
+}
+
+func TestBackfillCreatedAt(t *testing.T) {
+	var command bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName == "update" {
+				command = evt.Command
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("missing created_at", func(mt *mtest.T) {
+		// One legacy document has no created_at and gets it from its ObjectID
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.BackfillCreatedAt(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/backfill-created-at", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != `{"updated":1}` {
+			t.Errorf("body = %s, want {\"updated\":1}", got)
+		}
+
+		statement := command.Lookup("updates").Array().Index(0).Value().Document()
+		if !strings.Contains(statement.Lookup("q").String(), `{"created_at": null}`) {
+			t.Errorf("filter = %s, want it to match a missing created_at", statement.Lookup("q"))
+		}
+		set := statement.Lookup("u").Array().Index(0).Value().Document().Lookup("$set").Document()
+		createdAt := set.Lookup("created_at").String()
+		if !strings.Contains(createdAt, `"$toDate": "$_id"`) {
+			t.Errorf("created_at = %s, want it derived from the ObjectID", createdAt)
+		}
+	})
+}
+
+func TestTodoJSONOmitsUnsetFields(t *testing.T) {
+	data, err := json.Marshal(Todo{ID: primitive.NewObjectID(), Title: "Buy milk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"hidden_until", "metadata", "due_date"} {
+		if value, ok := fields[name]; ok {
+			t.Errorf("%s = %s, want it omitted", name, value)
+		}
+	}
+}
+
+func TestMongoURIFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "mongodb://localhost:27017"},
+		{name: "uri wins", env: map[string]string{"MONGODB_URI": "mongodb://db:27017/app", "MONGO_HOST": "other"}, want: "mongodb://db:27017/app"},
+		{name: "host only", env: map[string]string{"MONGO_HOST": "db"}, want: "mongodb://db:27017/"},
+		{name: "escaped credentials", env: map[string]string{"MONGO_HOST": "db", "MONGO_PORT": "27018", "MONGO_USER": "app", "MONGO_PASSWORD": "p@ss/word"}, want: "mongodb://app:p%40ss%2Fword@db:27018/"},
+		{name: "auth source", env: map[string]string{"MONGO_HOST": "db", "MONGO_USER": "app", "MONGO_PASSWORD": "secret", "MONGO_AUTH_SOURCE": "app"}, want: "mongodb://app:secret@db:27017/?authSource=app"},
+		{name: "database does not pick auth source", env: map[string]string{"MONGO_HOST": "db", "MONGO_USER": "app", "MONGO_PASSWORD": "secret", "MONGO_DB": "todos"}, want: "mongodb://app:secret@db:27017/"},
+		{name: "tls", env: map[string]string{"MONGO_HOST": "db", "MONGO_TLS": "1"}, want: "mongodb://db:27017/?tls=true"},
+		{name: "missing host", env: map[string]string{"MONGO_PORT": "27017"}, wantErr: true},
+		{name: "bad port", env: map[string]string{"MONGO_HOST": "db", "MONGO_PORT": "mongo"}, wantErr: true},
+		{name: "user without password", env: map[string]string{"MONGO_HOST": "db", "MONGO_USER": "app"}, wantErr: true},
+		{name: "bad tls", env: map[string]string{"MONGO_HOST": "db", "MONGO_TLS": "maybe"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"MONGODB_URI", "MONGO_HOST", "MONGO_PORT", "MONGO_USER", "MONGO_PASSWORD", "MONGO_AUTH_SOURCE", "MONGO_DB", "MONGO_TLS"} {
+				t.Setenv(name, tt.env[name])
+			}
+
+			got, err := mongoURIFromEnv()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+func TestMongoDatabaseFromEnv(t *testing.T) {
+	t.Setenv("MONGO_DB", "")
+	if got := mongoDatabaseFromEnv(); got != "todoapp" {
+		t.Errorf("unset: got %q, want todoapp", got)
+	}
+	t.Setenv("MONGO_DB", "todos_staging")
+	if got := mongoDatabaseFromEnv(); got != "todos_staging" {
+		t.Errorf("MONGO_DB=todos_staging: got %q", got)
+	}
+}
+
+func TestDuplicateTitleIncludesExistingID(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("create and update", func(mt *mtest.T) {
+		existingID := primitive.NewObjectID()
+		existing := mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: existingID}, {Key: "title", Value: "Buy milk"}})
+		mt.AddMockResponses(existing, existing)
+		h := NewTodoHandler(mt.Coll)
+		body := `{"title":"Buy milk"}`
+
+		create := httptest.NewRecorder()
+		h.CreateTodo(create, httptest.NewRequest(http.MethodPost, "/api/v1/todos", strings.NewReader(body)))
+
+		r := todoRequest(http.MethodPut, primitive.NewObjectID())
+		r.Body = io.NopCloser(strings.NewReader(body))
+		update := httptest.NewRecorder()
+		h.UpdateTodo(update, r)
+
+		for name, rec := range map[string]*httptest.ResponseRecorder{"create": create, "update": update} {
+			var conflict map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &conflict); err != nil {
+				t.Fatalf("%s: decoding body: %v", name, err)
+			}
+			if rec.Code != http.StatusConflict || conflict["code"] != CodeDuplicateTitle {
+				t.Errorf("%s: got %d %s, want 409 DUPLICATE_TITLE", name, rec.Code, rec.Body)
+			}
+			if conflict["existing_id"] != formatTodoID(existingID) {
+				t.Errorf("%s: existing_id = %q, want %s", name, conflict["existing_id"], formatTodoID(existingID))
+			}
+		}
+	})
+}
+
+func TestDeleteTodoIfMatch(t *testing.T) {
+	// A soft delete is an update, a hard one a delete; either way the
+	// filter carries the precondition
+	var deleteCommand string
+	var deleteFilter bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			switch evt.CommandName {
+			case "update":
+				deleteFilter = evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+			case "delete":
+				deleteFilter = evt.Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+			default:
+				return
+			}
+			deleteCommand = evt.CommandName
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	deleteRequest := func(id primitive.ObjectID) *http.Request {
+		r := todoRequest(http.MethodDelete, id)
+		r.Header.Set("If-Match", `"3"`)
+		return r
+	}
+
+	mt.Run("matched", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.DeleteTodo(rec, deleteRequest(primitive.NewObjectID()))
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", rec.Code)
+		}
+		if got, ok := deleteFilter.Lookup("version").AsInt64OK(); !ok || got != 3 || deleteCommand != "update" {
+			t.Errorf("%s filter = %s, want a soft delete matching version 3", deleteCommand, deleteFilter)
+		}
+	})
+
+	mt.Run("matched hard", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}})
+		h := NewTodoHandler(mt.Coll)
+
+		r := deleteRequest(primitive.NewObjectID())
+		r.URL.RawQuery = "hard=true"
+		rec := httptest.NewRecorder()
+		h.DeleteTodo(rec, r)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, want 204", rec.Code)
+		}
+		if got, ok := deleteFilter.Lookup("version").AsInt64OK(); !ok || got != 3 || deleteCommand != "delete" {
+			t.Errorf("%s filter = %s, want a hard delete matching version 3", deleteCommand, deleteFilter)
+		}
+	})
+
+	mt.Run("stale", func(mt *mtest.T) {
+		// Nothing matched the precondition, but the todo is still there
+		mt.AddMockResponses(
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}},
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.DeleteTodo(rec, deleteRequest(primitive.NewObjectID()))
+		if rec.Code != http.StatusPreconditionFailed || !strings.Contains(rec.Body.String(), CodeStaleDelete) {
+			t.Errorf("got %d %s, want 412 STALE_DELETE", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestParseTimezoneDefault(t *testing.T) {
+	defer func(loc *time.Location) { defaultLocation = loc }(defaultLocation)
+	defaultLocation = time.FixedZone("UTC+9", 9*60*60)
+	createdAt := time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/api/v1/todos", "2024-05-02T05:00:00+09:00"},
+		{"/api/v1/todos?tz=UTC", "2024-05-01T20:00:00Z"},
+	}
+	for _, tt := range tests {
+		loc, err := parseTimezone(httptest.NewRequest(http.MethodGet, tt.target, nil))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.target, err)
+		}
+		if got := newTodoResponse(Todo{CreatedAt: createdAt}, loc).CreatedAtLocal; got != tt.want {
+			t.Errorf("%s: created_at_local = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+
+	// Without DEFAULT_TZ nothing is added
+	defaultLocation = nil
+	if loc, err := parseTimezone(httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil)); loc != nil || err != nil {
+		t.Errorf("no DEFAULT_TZ: got %v, %v, want no location", loc, err)
+	}
+}
+
+func TestUpdateTodoReturnChanges(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("description only", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			// No duplicate title
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch),
+			// The document as it was before the update
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+				{Key: "_id", Value: id},
+				{Key: "title", Value: "Buy milk"},
+				{Key: "description", Value: "1 litre"},
+				{Key: "completed", Value: false},
+				{Key: "status", Value: StatusTodo},
+				{Key: "created_at", Value: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+				{Key: "updated_at", Value: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+			}}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		r := todoRequest(http.MethodPut, id)
+		r.URL.RawQuery = "return=changes"
+		r.Body = io.NopCloser(strings.NewReader(`{"title":"Buy milk","description":"2 litres"}`))
+		rec := httptest.NewRecorder()
+		h.UpdateTodo(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+
+		var changes map[string]interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &changes); err != nil {
+			t.Fatal(err)
+		}
+		if len(changes) != 4 || changes["id"] != formatTodoID(id) || changes["description"] != "2 litres" || changes["updated_at"] == nil || changes["version"] != float64(1) {
+			t.Errorf("got %v, want only id, updated_at, version and the new description", changes)
+		}
+	})
+}
+
+func TestParseBoolParam(t *testing.T) {
+	tests := []struct {
+		query   string
+		want    bool
+		wantErr bool
+	}{
+		{"", false, false},
+		{"flag=", false, false},
+		{"flag=true", true, false},
+		{"flag=1", true, false},
+		{"flag=false", false, false},
+		{"flag=0", false, false},
+		{"flag=True", false, true},
+		{"flag=TRUE", false, true},
+		{"flag=yes", false, true},
+		{"flag=no", false, true},
+		{"flag=on", false, true},
+		{"flag=%20true", false, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/todos?"+tt.query, nil)
+		got, err := parseBoolParam(r, "flag")
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("?%s: got %v, %v, want %v (error %v)", tt.query, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGetTodosRejectsInvalidBool(t *testing.T) {
+	h := NewTodoHandler(nil)
+	for _, param := range []string{"include_hidden", "completed", "overdue"} {
+		rec := httptest.NewRecorder()
+		h.GetTodos(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos?"+param+"=yes", nil))
+
+		var body map[string]string
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: body %q is not JSON: %v", param, rec.Body, err)
+		}
+		if rec.Code != http.StatusBadRequest || body["code"] != CodeInvalidBool || body["param"] != param {
+			t.Errorf("%s=yes: got %d %v, want 400 INVALID_BOOL naming %s", param, rec.Code, body, param)
+		}
+	}
+}
+
+func TestJitteredRetryAfter(t *testing.T) {
+	tests := []struct {
+		base, jitter time.Duration
+		min, max     int
+	}{
+		{0, 0, 1, 1},
+		{time.Second, 0, 1, 1},
+		{1500 * time.Millisecond, 0, 2, 2},
+		{time.Second, 4 * time.Second, 1, 5},
+		{10 * time.Second, 500 * time.Millisecond, 10, 11},
+	}
+	for _, tt := range tests {
+		seen := map[int]bool{}
+		for i := 0; i < 1000; i++ {
+			got := jitteredRetryAfter(tt.base, tt.jitter)
+			if got < tt.min || got > tt.max {
+				t.Fatalf("jitteredRetryAfter(%v, %v) = %d, want %d to %d", tt.base, tt.jitter, got, tt.min, tt.max)
+			}
+			seen[got] = true
+		}
+		// With jitter the values should spread over the range
+		if tt.jitter >= time.Second && len(seen) < 2 {
+			t.Errorf("jitteredRetryAfter(%v, %v) always returned %v", tt.base, tt.jitter, seen)
+		}
+	}
+}
+
+func TestCreateTodoIfAbsent(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	existingID := primitive.NewObjectID()
+	existing := bson.D{{Key: "_id", Value: existingID}, {Key: "title", Value: "Buy milk"}}
+
+	createRequest := func(query, ifNoneMatch string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/v1/todos"+query, strings.NewReader(`{"title":"Buy milk"}`))
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		return r
+	}
+
+	for _, tt := range []struct {
+		name, query, ifNoneMatch string
+	}{
+		{"query", "?if_absent=true", ""},
+		{"header", "", "*"},
+	} {
+		mt.Run(tt.name+" title exists", func(mt *mtest.T) {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, existing),
+				bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: existing}},
+			)
+			h := NewTodoHandler(mt.Coll)
+
+			rec := httptest.NewRecorder()
+			h.CreateTodo(rec, createRequest(tt.query, tt.ifNoneMatch))
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+			}
+			var todo Todo
+			if err := json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+				t.Fatal(err)
+			}
+			if todo.ID != existingID {
+				t.Errorf("id = %s, want the existing todo %s", todo.ID.Hex(), existingID.Hex())
+			}
+		})
+
+		mt.Run(tt.name+" title absent", func(mt *mtest.T) {
+			mt.AddMockResponses(
+				mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch),
+				// The upsert inserted, so there was no previous document
+				bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			)
+			h := NewTodoHandler(mt.Coll)
+
+			rec := httptest.NewRecorder()
+			h.CreateTodo(rec, createRequest(tt.query, tt.ifNoneMatch))
+			if rec.Code != http.StatusCreated {
+				t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body)
+			}
+			var todo Todo
+			if err := json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+				t.Fatal(err)
+			}
+			if todo.ID.IsZero() || todo.ID == existingID {
+				t.Errorf("id = %s, want a new todo", todo.ID.Hex())
+			}
+		})
+	}
+
+	mt.Run("without if_absent", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, existing))
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.CreateTodo(rec, createRequest("", ""))
+		if rec.Code != http.StatusConflict {
+			t.Errorf("status = %d, want 409", rec.Code)
+		}
+	})
+}
+
+func TestDBContextFollowsRequest(t *testing.T) {
+	h := NewTodoHandler(nil)
+	h.dbTimeout = time.Minute
+
+	reqCtx, cancelRequest := context.WithCancel(context.Background())
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/todos", nil).WithContext(reqCtx)
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("deadline = %v, %v, want within DB_TIMEOUT", deadline, ok)
+	}
+
+	// A client disconnecting cancels its database work
+	cancelRequest()
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("database context outlived the request")
+	}
+}
+
+func TestDeleteTodoCancelledRequest(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("cancelled", func(mt *mtest.T) {
+		// The database would accept the delete, but the client has gone
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+		h := NewTodoHandler(mt.Coll)
+		r := todoRequest(http.MethodDelete, primitive.NewObjectID())
+		ctx, cancel := context.WithCancel(r.Context())
+		cancel()
+
+		rec := httptest.NewRecorder()
+		h.DeleteTodo(rec, r.WithContext(ctx))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want the delete abandoned with 500", rec.Code)
+		}
+	})
+}
+
+func TestDeleteTodoDBTimeout(t *testing.T) {
+	// The database answers slower than DB_TIMEOUT allows
+	monitor := &event.CommandMonitor{
+		Started: func(context.Context, *event.CommandStartedEvent) { time.Sleep(50 * time.Millisecond) },
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("timeout", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}, {Key: "nModified", Value: 1}})
+		h := NewTodoHandler(mt.Coll)
+		h.dbTimeout = 10 * time.Millisecond
+
+		rec := httptest.NewRecorder()
+		h.DeleteTodo(rec, todoRequest(http.MethodDelete, primitive.NewObjectID()))
+		if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), CodeDBTimeout) {
+			t.Errorf("got %d %s, want 503 DB_TIMEOUT", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestGetTodosRejectsOverdueWithCompleted(t *testing.T) {
+	h := NewTodoHandler(nil)
+	rec := httptest.NewRecorder()
+	h.GetTodos(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos?overdue=true&completed=true", nil))
+
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeConflictingFilters) {
+		t.Errorf("got %d %s, want 400 %s", rec.Code, rec.Body, CodeConflictingFilters)
+	}
+}
+
+func TestDeleteCompletedTodos(t *testing.T) {
+	var command string
+	var filter bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			switch evt.CommandName {
+			case "update":
+				filter = evt.Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("q").Document()
+			case "delete":
+				filter = evt.Command.Lookup("deletes").Array().Index(0).Value().Document().Lookup("q").Document()
+			default:
+				return
+			}
+			command = evt.CommandName
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	tests := []struct {
+		name, query, command string
+		skipsDeleted         bool
+	}{
+		{name: "soft", query: "", command: "update", skipsDeleted: true},
+		{name: "hard", query: "?hard=true", command: "delete", skipsDeleted: false},
+	}
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 2}, {Key: "nModified", Value: 2}})
+			h := NewTodoHandler(mt.Coll)
+
+			rec := httptest.NewRecorder()
+			h.DeleteCompletedTodos(rec, httptest.NewRequest(http.MethodDelete, "/api/v1/todos/completed"+tt.query, nil))
+			if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"deleted":2}` {
+				t.Fatalf("got %d %s, want 200 with 2 deleted", rec.Code, rec.Body)
+			}
+			if command != tt.command {
+				t.Errorf("sent %s, want %s", command, tt.command)
+			}
+			// Only a soft delete leaves todos that are already deleted alone
+			_, err := filter.LookupErr("deleted_at")
+			if skipsDeleted := err == nil; skipsDeleted != tt.skipsDeleted {
+				t.Errorf("filter %s: skips deleted = %v, want %v", filter, skipsDeleted, tt.skipsDeleted)
+			}
+		})
+	}
+}
+
+func TestValidateTodoInvalidDueDate(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("field error", func(mt *mtest.T) {
+		// No duplicate title
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch))
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.ValidateTodo(rec, httptest.NewRequest(http.MethodPost, "/api/v1/todos/validate", strings.NewReader(`{"title":"Buy milk","due_date":"tomorrow"}`)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+		}
+		var body struct {
+			Valid  bool         `json:"valid"`
+			Errors []FieldError `json:"errors"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Valid || len(body.Errors) != 1 || body.Errors[0].Field != "due_date" || body.Errors[0].Code != CodeInvalidDueDate {
+			t.Errorf("got %+v, want one INVALID_DUE_DATE field error", body)
+		}
+	})
+
+	mt.Run("with other field errors", func(mt *mtest.T) {
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.ValidateTodo(rec, httptest.NewRequest(http.MethodPost, "/api/v1/todos/validate", strings.NewReader(`{"title":"","due_date":42}`)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want 422: %s", rec.Code, rec.Body)
+		}
+		if !strings.Contains(rec.Body.String(), CodeMissingTitle) || !strings.Contains(rec.Body.String(), CodeInvalidDueDate) {
+			t.Errorf("body = %s, want both %s and %s", rec.Body, CodeMissingTitle, CodeInvalidDueDate)
+		}
+	})
+}
+
+func TestHandlersRejectBadBodies(t *testing.T) {
+	h := NewTodoHandler(nil)
+	handlers := map[string]http.HandlerFunc{
+		"create":   h.CreateTodo,
+		"validate": h.ValidateTodo,
+		"bulk":     h.BulkCreateTodos,
+		"sync":     h.SyncTodos,
+		"update":   h.UpdateTodo,
+		"patch":    h.PatchTodo,
+		"status":   h.UpdateTodoStatus,
+		"snooze":   h.SnoozeTodo,
+		"workflow": h.TransitionTodo,
+		"merge":    h.MergeTodos,
+	}
+	bodies := []struct {
+		body, code string
+	}{
+		{"", CodeEmptyBody},
+		{`{"title":`, CodeInvalidJSON},
+	}
+
+	// The body is decoded before any database call
+	for name, handler := range handlers {
+		for _, tt := range bodies {
+			r := todoRequest(http.MethodPost, primitive.NewObjectID())
+			r.Body = io.NopCloser(strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			handler(rec, r)
+
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("%s: body %q is not JSON: %v", name, rec.Body, err)
+			}
+			if rec.Code != http.StatusBadRequest || body["code"] != tt.code {
+				t.Errorf("%s with %q: got %d %v, want 400 %s", name, tt.body, rec.Code, body, tt.code)
+			}
+		}
+	}
+}
+
+func TestDecodeBodyInvalidDueDate(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/todos", strings.NewReader(`{"title":"Buy milk","due_date":"tomorrow"}`))
+	rec := httptest.NewRecorder()
+
+	var todo Todo
+	if decodeBody(rec, r, &todo) {
+		t.Fatal("decodeBody accepted an invalid due_date")
+	}
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeInvalidDueDate) {
+		t.Errorf("got %d %s, want 400 %s", rec.Code, rec.Body, CodeInvalidDueDate)
+	}
+}
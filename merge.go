@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mergeTodos folds source into target: descriptions are concatenated,
+// metadata is combined with target values winning, tags are unioned, and
+// the earlier created_at is kept. The target's title is kept, so the merge can never
+// collide with the unique title index.
+func mergeTodos(source, target Todo) Todo {
+	merged := target
+
+	switch {
+	case merged.Description == "":
+		merged.Description = source.Description
+	case source.Description != "" && source.Description != merged.Description:
+		merged.Description = merged.Description + "\n\n" + source.Description
+	}
+
+	if len(source.Metadata) > 0 {
+		metadata := make(map[string]string, len(source.Metadata)+len(target.Metadata))
+		for key, value := range source.Metadata {
+			metadata[key] = value
+		}
+		for key, value := range target.Metadata {
+			metadata[key] = value
+		}
+		merged.Metadata = metadata
+	}
+
+	merged.Tags = normalizeTags(append(append([]string(nil), target.Tags...), source.Tags...))
+
+	if source.CreatedAt.Before(merged.CreatedAt) {
+		merged.CreatedAt = source.CreatedAt
+	}
+
+	return merged
+}
+
+// MergeTodos handles POST /todos/merge
+func (h *TodoHandler) MergeTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	var request struct {
+		Source string `json:"source"`
+		Target string `json:"target"`
+	}
+	if !decodeBody(w, r, &request) {
+		return
+	}
+
+	sourceID, sourceErr := parseTodoID(request.Source)
+	targetID, targetErr := parseTodoID(request.Target)
+	if sourceErr != nil || targetErr != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+	if sourceID == targetID {
+		writeError(w, http.StatusBadRequest, CodeInvalidMerge, "A todo cannot be merged into itself")
+		return
+	}
+
+	var source, target Todo
+	for _, lookup := range []struct {
+		id   primitive.ObjectID
+		todo *Todo
+	}{{sourceID, &source}, {targetID, &target}} {
+		err := h.collection.FindOne(ctx, visible(ctx, bson.M{"_id": lookup.id})).Decode(lookup.todo)
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+			return
+		} else if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to fetch todo")
+			return
+		}
+	}
+
+	merged := mergeTodos(source, target)
+	merged.UpdatedAt = time.Now()
+	if fieldError := validateMetadata(merged.Metadata); fieldError != nil {
+		writeFieldError(w, *fieldError)
+		return
+	}
+
+	// Update the target before removing the source so a failure part way
+	// through never loses data
+	update := setUpdate(bson.M{
+		"description": merged.Description,
+		"metadata":    merged.Metadata,
+		"tags":        merged.Tags,
+		"created_at":  merged.CreatedAt,
+		"updated_at":  merged.UpdatedAt,
+	}, merged.UpdatedAt)
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := h.collection.FindOneAndUpdate(ctx, visible(ctx, bson.M{"_id": targetID}), update, opts).Decode(&merged)
+	h.invalidate(targetID)
+	if err == mongo.ErrNoDocuments {
+		// Deleted since it was read; the source is left untouched
+		writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+		return
+	} else if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to update merge target")
+		return
+	}
+
+	// The source is soft deleted, so a merge can be undone with restore
+	deleted := bson.M{"$set": bson.M{"deleted_at": merged.UpdatedAt}, "$inc": bson.M{"version": 1}}
+	_, err = h.collection.UpdateOne(ctx, visible(ctx, bson.M{"_id": sourceID}), deleted)
+	h.invalidate(sourceID)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Merged into target but failed to delete source")
+		return
+	}
+
+	json.NewEncoder(w).Encode(merged)
+}
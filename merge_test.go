@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMergeTodosFields(t *testing.T) {
+	earlier := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+	source := Todo{
+		Title:       "Milk",
+		Description: "Semi-skimmed",
+		CreatedAt:   earlier,
+		Metadata:    map[string]string{"shop": "corner", "aisle": "3"},
+		Tags:        []string{"dairy", "errands"},
+	}
+	target := Todo{
+		Title:       "Groceries",
+		Description: "Weekly shop",
+		CreatedAt:   later,
+		Metadata:    map[string]string{"shop": "market"},
+		Tags:        []string{"errands", "weekly"},
+	}
+
+	merged := mergeTodos(source, target)
+	if merged.Title != "Groceries" {
+		t.Errorf("title = %q, want the target's", merged.Title)
+	}
+	if merged.Description != "Weekly shop\n\nSemi-skimmed" {
+		t.Errorf("description = %q, want both joined", merged.Description)
+	}
+	if merged.Metadata["shop"] != "market" || merged.Metadata["aisle"] != "3" {
+		t.Errorf("metadata = %v, want both with the target winning", merged.Metadata)
+	}
+	if strings.Join(merged.Tags, ",") != "errands,weekly,dairy" {
+		t.Errorf("tags = %v, want the union with the target's first", merged.Tags)
+	}
+	if !merged.CreatedAt.Equal(earlier) {
+		t.Errorf("created_at = %v, want the earlier %v", merged.CreatedAt, earlier)
+	}
+
+	// Identical descriptions are not repeated
+	target.Description = source.Description
+	if got := mergeTodos(source, target).Description; got != "Semi-skimmed" {
+		t.Errorf("same description: got %q", got)
+	}
+}
+
+// mergeRequest builds a POST /todos/merge request
+func mergeRequest(source, target primitive.ObjectID) *http.Request {
+	body := `{"source":"` + source.Hex() + `","target":"` + target.Hex() + `"}`
+	return httptest.NewRequest(http.MethodPost, "/api/v1/todos/merge", strings.NewReader(body))
+}
+
+func TestMergeTodos(t *testing.T) {
+	var commands []string
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			commands = append(commands, evt.CommandName)
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("merged", func(mt *mtest.T) {
+		sourceID, targetID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: sourceID}, {Key: "title", Value: "Milk"}, {Key: "description", Value: "Semi-skimmed"}}),
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: targetID}, {Key: "title", Value: "Groceries"}}),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: bson.D{
+				{Key: "_id", Value: targetID}, {Key: "title", Value: "Groceries"}, {Key: "description", Value: "Semi-skimmed"},
+			}}},
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 1}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.MergeTodos(rec, mergeRequest(sourceID, targetID))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var merged Todo
+		if err := json.Unmarshal(rec.Body.Bytes(), &merged); err != nil {
+			t.Fatal(err)
+		}
+		if merged.ID != targetID || merged.Description != "Semi-skimmed" {
+			t.Errorf("got %+v, want the updated target", merged)
+		}
+		// The source is soft deleted rather than removed
+		if last := commands[len(commands)-1]; last != "update" {
+			t.Errorf("source removed with %s, want a soft delete update", last)
+		}
+	})
+
+	mt.Run("self merge", func(mt *mtest.T) {
+		h := NewTodoHandler(mt.Coll)
+		id := primitive.NewObjectID()
+
+		rec := httptest.NewRecorder()
+		h.MergeTodos(rec, mergeRequest(id, id))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeInvalidMerge) {
+			t.Errorf("got %d %s, want 400 INVALID_MERGE", rec.Code, rec.Body)
+		}
+	})
+
+	mt.Run("missing source", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch))
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.MergeTodos(rec, mergeRequest(primitive.NewObjectID(), primitive.NewObjectID()))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404", rec.Code)
+		}
+	})
+
+	mt.Run("target deleted meanwhile", func(mt *mtest.T) {
+		commands = nil
+		sourceID, targetID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: sourceID}, {Key: "title", Value: "Milk"}}),
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: targetID}, {Key: "title", Value: "Groceries"}}),
+			// The target is gone by the time it is updated
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.MergeTodos(rec, mergeRequest(sourceID, targetID))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want 404: %s", rec.Code, rec.Body)
+		}
+		if last := commands[len(commands)-1]; last != "findAndModify" {
+			t.Errorf("sent %s after the failed update, want the source left alone", last)
+		}
+	})
+}
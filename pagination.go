@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// List pagination defaults and bounds
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// sortableFields are the fields GET /todos may be sorted by
+var sortableFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"title":      true,
+	"status":     true,
+	"completed":  true,
+	"priority":   true,
+}
+
+// TodoPage is the envelope returned by GET /todos
+type TodoPage struct {
+	Data  []TodoResponse `json:"data"`
+	Page  int64          `json:"page"`
+	Limit int64          `json:"limit"`
+	Total int64          `json:"total"`
+}
+
+// pageRequest holds validated page, limit, sort and order parameters
+type pageRequest struct {
+	Page  int64
+	Limit int64
+	Sort  string
+	Order int
+}
+
+// parsePage reads ?page=&limit=&sort=&order=, defaulting to the first 20
+// todos by created_at, newest first
+func parsePage(r *http.Request) (pageRequest, *FieldError) {
+	query := r.URL.Query()
+	page := pageRequest{Page: 1, Limit: defaultPageLimit, Sort: "created_at", Order: -1}
+
+	if raw := query.Get("page"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			return page, &FieldError{Field: "page", Error: "page must be a positive integer", Code: CodeInvalidPage}
+		}
+		page.Page = n
+	}
+
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 || n > maxPageLimit {
+			return page, &FieldError{Field: "limit", Error: "limit must be an integer between 1 and 100", Code: CodeInvalidLimit}
+		}
+		page.Limit = n
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		if !sortableFields[sort] {
+			return page, &FieldError{Field: "sort", Error: "sort must be one of created_at, updated_at, title, status, completed, priority", Code: CodeInvalidSort}
+		}
+		page.Sort = sort
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		page.Order = 1
+	default:
+		return page, &FieldError{Field: "order", Error: "order must be asc or desc", Code: CodeInvalidOrder}
+	}
+
+	return page, nil
+}
+
+// findOptions translates the page into skip, limit and sort. _id breaks ties
+// so pages stay stable when sort values repeat.
+func (p pageRequest) findOptions() *options.FindOptions {
+	return options.Find().
+		SetSkip((p.Page - 1) * p.Limit).
+		SetLimit(p.Limit).
+		SetSort(bson.D{{Key: p.Sort, Value: p.Order}, {Key: "_id", Value: p.Order}})
+}
+
+// find runs the page query. Priorities do not sort alphabetically, so a
+// priority sort goes through an aggregation on a computed rank instead.
+func (p pageRequest) find(ctx context.Context, collection *mongo.Collection, filter bson.M) (*mongo.Cursor, error) {
+	if p.Sort != "priority" {
+		return collection.Find(ctx, filter, p.findOptions())
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$addFields", Value: bson.M{"_priority_rank": priorityRankExpr()}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_priority_rank", Value: p.Order}, {Key: "_id", Value: p.Order}}}},
+		{{Key: "$skip", Value: (p.Page - 1) * p.Limit}},
+		{{Key: "$limit", Value: p.Limit}},
+		{{Key: "$unset", Value: "_priority_rank"}},
+	}
+	return collection.Aggregate(ctx, pipeline)
+}
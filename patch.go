@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// todoPatch is the body of PATCH /todos/{id}. Pointer fields tell an
+// omitted field apart from one set to its zero value.
+type todoPatch struct {
+	Title       *string            `json:"title"`
+	Description *string            `json:"description"`
+	Completed   *bool              `json:"completed"`
+	Status      *string            `json:"status"`
+	Metadata    *map[string]string `json:"metadata"`
+	Priority    *string            `json:"priority"`
+	Tags        *[]string          `json:"tags"`
+	// DueDate stays raw so an explicit null, which clears the due date, can
+	// be told apart from an omitted field
+	DueDate json.RawMessage `json:"due_date"`
+}
+
+// PatchTodo handles PATCH /todos/{id}. Only the fields present in the body
+// are written; updated_at always advances.
+func (h *TodoHandler) PatchTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	expectedVersion, conditional, err := parseIfMatch(r)
+	if err != nil {
+		writeInvalidIfMatch(w)
+		return
+	}
+
+	var patch todoPatch
+	if !decodeBody(w, r, &patch) {
+		return
+	}
+
+	if patch.Status != nil && !validStatuses[*patch.Status] {
+		writeFieldError(w, FieldError{
+			Field: "status",
+			Error: "Status must be one of todo, in_progress, done, blocked",
+			Code:  CodeInvalidStatus,
+		})
+		return
+	}
+	dueDate, err := decodeDueDate(patch.DueDate)
+	if err != nil {
+		writeInvalidDueDate(w)
+		return
+	}
+	if patch.Priority != nil {
+		if _, ok := priorityRanks[*patch.Priority]; !ok {
+			writeFieldError(w, FieldError{
+				Field: "priority",
+				Error: "Priority must be one of low, medium, high",
+				Code:  CodeInvalidPriority,
+			})
+			return
+		}
+	}
+	if patch.Metadata != nil {
+		if fieldError := validateMetadata(*patch.Metadata); fieldError != nil {
+			writeFieldError(w, *fieldError)
+			return
+		}
+	}
+
+	// The title goes through the same checks as on create, uniqueness
+	// included
+	if patch.Title != nil {
+		fieldErrors, err := h.validateTodo(ctx, Todo{Title: *patch.Title}, id)
+		if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to check title uniqueness")
+			return
+		}
+		if len(fieldErrors) > 0 {
+			writeFieldError(w, fieldErrors[0])
+			return
+		}
+	}
+
+	now := time.Now()
+	values := bson.M{"updated_at": now}
+	if patch.Title != nil {
+		values["title"] = *patch.Title
+	}
+	if patch.Description != nil {
+		values["description"] = *patch.Description
+	}
+	if patch.Metadata != nil {
+		values["metadata"] = *patch.Metadata
+	}
+	if patch.DueDate != nil {
+		values["due_date"] = dueDate
+	}
+	if patch.Priority != nil {
+		values["priority"] = *patch.Priority
+	}
+	if patch.Tags != nil {
+		values["tags"] = normalizeTags(*patch.Tags)
+	}
+	// An explicit status wins and sets completed to match, as on PUT
+	if patch.Status != nil {
+		values["status"] = *patch.Status
+		values["completed"] = *patch.Status == StatusDone
+	}
+
+	update := mongo.Pipeline{literalSet(values)}
+	if patch.Status == nil && patch.Completed != nil {
+		update = append(update, bson.D{{Key: "$set", Value: bson.M{
+			"completed": *patch.Completed,
+			"status":    statusForCompleted(*patch.Completed),
+		}}})
+	}
+	update = append(update, versionIncrement)
+	if fieldTimestamps {
+		update = withFieldTimestamps(update, now)
+	}
+
+	// A status or completed change has to follow the workflow rules
+	filter := visible(ctx, bson.M{"_id": id})
+	if conditional {
+		matchVersion(filter, expectedVersion)
+	}
+	var next func(from string) string
+	if patch.Status != nil {
+		next = toStatus(*patch.Status)
+	} else if patch.Completed != nil {
+		next = forCompleted(*patch.Completed)
+	}
+	if next != nil {
+		guardTransition(filter, next)
+	}
+
+	var updatedTodo Todo
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updatedTodo)
+	h.invalidate(id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments && next != nil {
+			h.writeRejectedUpdate(ctx, w, id, expectedVersion, conditional, next)
+		} else if err == mongo.ErrNoDocuments {
+			h.writeMissingOrConflict(ctx, w, id, conditional)
+		} else if mongo.IsDuplicateKeyError(err) {
+			writeDuplicateTitle(w)
+		} else {
+			writeDatabaseError(ctx, w, err, "Failed to update todo")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(updatedTodo.Version))
+	json.NewEncoder(w).Encode(updatedTodo)
+}
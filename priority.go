@@ -0,0 +1,42 @@
+package main
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Priority levels. Todos stored without one are treated as medium.
+const (
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+)
+
+// priorityRanks orders priorities for sorting, higher meaning more urgent
+var priorityRanks = map[string]int{
+	PriorityLow:    1,
+	PriorityMedium: 2,
+	PriorityHigh:   3,
+}
+
+// defaultPriority fills in a missing priority as medium
+func defaultPriority(todo *Todo) {
+	if todo.Priority == "" {
+		todo.Priority = PriorityMedium
+	}
+}
+
+// priorityRankExpr is an aggregation expression for the sort rank of a
+// todo's priority. Missing or unknown values rank as medium.
+func priorityRankExpr() bson.M {
+	branches := bson.A{}
+	for priority, rank := range priorityRanks {
+		branches = append(branches, bson.M{
+			"case": bson.M{"$eq": bson.A{"$priority", priority}},
+			"then": rank,
+		})
+	}
+	return bson.M{"$switch": bson.M{
+		"branches": branches,
+		"default":  priorityRanks[PriorityMedium],
+	}}
+}
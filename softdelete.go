@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notDeleted narrows filter to todos that have not been soft deleted. A
+// missing deleted_at matches too, which covers todos stored before soft
+// delete existed.
+func notDeleted(filter bson.M) bson.M {
+	filter["deleted_at"] = nil
+	return filter
+}
+
+// RestoreTodo handles POST /todos/{id}/restore. It clears deleted_at on a
+// soft-deleted todo. Restoring fails with 409 DUPLICATE_TITLE when another
+// todo has taken the title in the meantime.
+func (h *TodoHandler) RestoreTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}, "$inc": bson.M{"version": 1}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var restored Todo
+	err = h.collection.FindOneAndUpdate(ctx, ownedBy(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$ne": nil}}), update, opts).Decode(&restored)
+	h.invalidate(id)
+	if err != nil {
+		switch {
+		case err == mongo.ErrNoDocuments:
+			writeError(w, http.StatusNotFound, CodeNotFound, "Deleted todo not found")
+		case mongo.IsDuplicateKeyError(err):
+			writeDuplicateTitle(w)
+		default:
+			writeDatabaseError(ctx, w, err, "Failed to restore todo")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", versionETag(restored.Version))
+	json.NewEncoder(w).Encode(restored)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// PrometheusStats handles GET /todos/stats/prometheus. It renders current
+// todo counts as gauges in the Prometheus text exposition format, so a
+// textfile collector or simple scraper can pick them up.
+func (h *TodoHandler) PrometheusStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	gauges := []struct {
+		name   string
+		help   string
+		filter bson.M
+		value  int64
+	}{
+		{name: "todos", help: "Number of todos.", filter: bson.M{}},
+		{name: "todos_completed", help: "Number of completed todos.", filter: bson.M{"completed": true}},
+		{name: "todos_pending", help: "Number of todos not yet completed.", filter: bson.M{"completed": bson.M{"$ne": true}}},
+		{name: "todos_overdue", help: "Number of todos not yet completed whose due date has passed.", filter: bson.M{"completed": bson.M{"$ne": true}, "due_date": bson.M{"$lt": time.Now()}}},
+	}
+
+	for i := range gauges {
+		count, err := h.readCollection.CountDocuments(ctx, visible(ctx, gauges[i].filter))
+		if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to count todos")
+			return
+		}
+		gauges[i].value = count
+	}
+
+	var b strings.Builder
+	for _, gauge := range gauges {
+		fmt.Fprintf(&b, "# HELP %s %s\n", gauge.name, gauge.help)
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", gauge.name)
+		fmt.Fprintf(&b, "%s %d\n", gauge.name, gauge.value)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestPrometheusStats(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("exposition", func(mt *mtest.T) {
+		// One count per gauge, in order
+		for _, n := range []int{5, 2, 3, 1} {
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, bson.D{{Key: "n", Value: n}}))
+		}
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.PrometheusStats(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos/stats/prometheus", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+		if got := rec.Header().Get("Content-Type"); got != "text/plain; version=0.0.4; charset=utf-8" {
+			t.Errorf("Content-Type = %q, want the text exposition format", got)
+		}
+
+		want := `# HELP todos Number of todos.
+# TYPE todos gauge
+todos 5
+# HELP todos_completed Number of completed todos.
+# TYPE todos_completed gauge
+todos_completed 2
+# HELP todos_pending Number of todos not yet completed.
+# TYPE todos_pending gauge
+todos_pending 3
+# HELP todos_overdue Number of todos not yet completed whose due date has passed.
+# TYPE todos_overdue gauge
+todos_overdue 1
+`
+		if got := rec.Body.String(); got != want {
+			t.Errorf("body =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	mt.Run("database error", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{Code: 1, Message: "boom"}))
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.PrometheusStats(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos/stats/prometheus", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("status = %d, want 500", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestHealthzSkipsDatabase(t *testing.T) {
+	// No client at all: healthz must not touch it
+	h := NewStatusHandler(nil, nil)
+	rec := httptest.NewRecorder()
+	h.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok"`) {
+		t.Errorf("got %d %s, want 200 ok", rec.Code, rec.Body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("ping fails", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateCommandErrorResponse(mtest.CommandError{
+			Code:    11600,
+			Name:    "InterruptedAtShutdown",
+			Message: "interrupted at shutdown",
+		}))
+		h := NewStatusHandler(mt.Client, mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), `"unavailable"`) {
+			t.Errorf("got %d %s, want 503 unavailable", rec.Code, rec.Body)
+		}
+	})
+
+	mt.Run("ping succeeds", func(mt *mtest.T) {
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}})
+		h := NewStatusHandler(mt.Client, mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.Readyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"ok"`) {
+			t.Errorf("got %d %s, want 200 ok", rec.Code, rec.Body)
+		}
+	})
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxSyncItems caps the number of todos in one POST /todos/sync request
+const maxSyncItems = 500
+
+// SyncResult is the outcome for one item of POST /todos/sync, in request
+// order
+type SyncResult struct {
+	Index  int    `json:"index"`
+	Title  string `json:"title"`
+	Result string `json:"result"` // created, updated or error
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+// SyncTodos handles POST /todos/sync. Each item is upserted on its title:
+// a new title creates a todo, a known one has its fields replaced as with
+// PUT, including the workflow rules for its status. All valid items go to
+// MongoDB in one unordered bulk write, so replaying the same list is
+// idempotent.
+func (h *TodoHandler) SyncTodos(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	var todos []Todo
+	if !decodeBody(w, r, &todos) {
+		return
+	}
+	if len(todos) > maxSyncItems {
+		writeError(w, http.StatusRequestEntityTooLarge, CodeTooManyItems, "At most 500 todos can be synced per request")
+		return
+	}
+
+	now := time.Now()
+	results := make([]SyncResult, len(todos))
+	// pending holds the items that passed validation, in request order
+	var pending []int
+	seen := map[string]int{}
+	for i := range todos {
+		todo := &todos[i]
+		results[i] = SyncResult{Index: i, Title: todo.Title}
+
+		if fieldErrors := h.validateFields(*todo); len(fieldErrors) > 0 {
+			results[i].Result = "error"
+			results[i].Error = fieldErrors[0].Error
+			results[i].Code = fieldErrors[0].Code
+			continue
+		}
+		// Two items upserting the same title would race each other
+		if first, ok := seen[todo.Title]; ok {
+			results[i].Result = "error"
+			results[i].Error = "Title repeats an earlier item in this request"
+			results[i].Code = CodeDuplicateTitle
+			results[first].Result = "error"
+			results[first].Error = results[i].Error
+			results[first].Code = results[i].Code
+			continue
+		}
+		seen[todo.Title] = i
+
+		syncStatus(todo)
+		defaultPriority(todo)
+		todo.Tags = normalizeTags(todo.Tags)
+		pending = append(pending, i)
+	}
+
+	// Drop items that were later found to repeat a title
+	kept := pending[:0]
+	for _, i := range pending {
+		if results[i].Result != "error" {
+			kept = append(kept, i)
+		}
+	}
+	pending = kept
+
+	// Known titles follow the workflow rules like any other status change
+	existing, err := h.findSyncTitles(ctx, pending, todos)
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to sync todos")
+		return
+	}
+
+	var models []mongo.WriteModel
+	// modelIndex maps a write model back to its item
+	var modelIndex []int
+	for _, i := range pending {
+		todo := todos[i]
+		filter := visible(ctx, bson.M{"title": todo.Title})
+		model := mongo.NewUpdateOneModel().SetUpdate(syncUpdate(todo, now))
+
+		if current, ok := existing[todo.Title]; ok {
+			if from := currentStatus(current); todo.Status != from && !canTransition(from, todo.Status) {
+				results[i].Result = "error"
+				results[i].Error = fmt.Sprintf("Cannot move a todo from %s to %s", from, todo.Status)
+				results[i].Code = CodeInvalidTransition
+				continue
+			}
+			// Only update the todo that was checked, and only while its
+			// status still allows the move
+			filter = visible(ctx, bson.M{"_id": current.ID})
+			guardTransition(filter, toStatus(todo.Status))
+		} else {
+			model.SetUpsert(true)
+		}
+		models = append(models, model.SetFilter(filter))
+		modelIndex = append(modelIndex, i)
+	}
+
+	if len(models) > 0 {
+		if err := h.runSync(ctx, models, modelIndex, todos, results); err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to sync todos")
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"results": results,
+	})
+}
+
+// syncUpdate builds the upsert for one synced todo. created_at is only set
+// when the todo is new; a new todo starts at version 1.
+func syncUpdate(todo Todo, now time.Time) interface{} {
+	values := bson.M{
+		"description": todo.Description,
+		"completed":   todo.Completed,
+		"status":      todo.Status,
+		"metadata":    todo.Metadata,
+		"due_date":    todo.DueDate,
+		"priority":    todo.Priority,
+		"tags":        todo.Tags,
+		"updated_at":  now,
+	}
+	if !fieldTimestamps {
+		return bson.M{
+			"$set":         values,
+			"$setOnInsert": bson.M{"created_at": now},
+			"$inc":         bson.M{"version": 1},
+		}
+	}
+
+	return withFieldTimestamps(mongo.Pipeline{
+		literalSet(values),
+		{{Key: "$set", Value: bson.M{"created_at": bson.M{"$ifNull": bson.A{"$created_at", now}}}}},
+		versionIncrement,
+	}, now)
+}
+
+// findSyncTitles reads the status of the todos that already have one of
+// the pending items' titles, keyed by title
+func (h *TodoHandler) findSyncTitles(ctx context.Context, pending []int, todos []Todo) (map[string]Todo, error) {
+	if len(pending) == 0 {
+		return nil, nil
+	}
+	titles := make([]string, 0, len(pending))
+	for _, i := range pending {
+		titles = append(titles, todos[i].Title)
+	}
+
+	opts := options.Find().SetProjection(bson.M{"title": 1, "status": 1, "completed": 1})
+	cursor, err := h.collection.Find(ctx, visible(ctx, bson.M{"title": bson.M{"$in": titles}}), opts)
+	if err != nil {
+		return nil, err
+	}
+	var found []Todo
+	if err := cursor.All(ctx, &found); err != nil {
+		return nil, err
+	}
+	existing := make(map[string]Todo, len(found))
+	for _, todo := range found {
+		existing[todo.Title] = todo
+	}
+	return existing, nil
+}
+
+// runSync executes the bulk write and fills in each item's outcome and id
+func (h *TodoHandler) runSync(ctx context.Context, models []mongo.WriteModel, modelIndex []int, todos []Todo, results []SyncResult) error {
+	result, err := h.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	failed := map[int64]mongo.BulkWriteError{}
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+			return err
+		}
+		for _, writeErr := range bulkErr.WriteErrors {
+			failed[int64(writeErr.Index)] = writeErr
+		}
+	}
+
+	var titles []string
+	for m, i := range modelIndex {
+		if writeErr, ok := failed[int64(m)]; ok {
+			results[i].Result = "error"
+			results[i].Error = writeErr.Message
+			results[i].Code = CodeDatabaseError
+			if writeErr.Code == 11000 {
+				results[i].Error = "Todo with this title already exists"
+				results[i].Code = CodeDuplicateTitle
+			}
+			continue
+		}
+
+		results[i].Result = "updated"
+		if result != nil {
+			if _, ok := result.UpsertedIDs[int64(m)]; ok {
+				results[i].Result = "created"
+			}
+		}
+		titles = append(titles, results[i].Title)
+	}
+
+	// Look the ids up afterwards; the bulk result only reports ids for
+	// upserted documents
+	h.invalidateAll()
+	if len(titles) == 0 {
+		return nil
+	}
+	opts := options.Find().SetProjection(bson.M{"title": 1, "status": 1, "completed": 1})
+	cursor, err := h.collection.Find(ctx, visible(ctx, bson.M{"title": bson.M{"$in": titles}}), opts)
+	if err != nil {
+		return err
+	}
+	var found []Todo
+	if err := cursor.All(ctx, &found); err != nil {
+		return err
+	}
+	stored := make(map[string]Todo, len(found))
+	for _, todo := range found {
+		stored[todo.Title] = todo
+	}
+	for _, i := range modelIndex {
+		if results[i].Result == "error" {
+			continue
+		}
+		todo, ok := stored[results[i].Title]
+		if ok {
+			results[i].ID = formatTodoID(todo.ID)
+		}
+		// A guarded update skips a todo whose status changed after it was
+		// checked
+		if results[i].Result == "updated" && (!ok || currentStatus(todo) != todos[i].Status) {
+			results[i].Result = "error"
+			results[i].Error = "Todo was modified concurrently, retry the sync"
+			results[i].Code = CodeConcurrentModification
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// syncRequest posts body to SyncTodos and decodes the per-item results
+func syncRequest(t *testing.T, h *TodoHandler, body string) (int, []SyncResult) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.SyncTodos(rec, httptest.NewRequest(http.MethodPost, "/api/v1/todos/sync", strings.NewReader(body)))
+
+	var resp struct {
+		Results []SyncResult `json:"results"`
+	}
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("body %q is not JSON: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, resp.Results
+}
+
+func TestSyncTodosMixedBatch(t *testing.T) {
+	var updates []bson.Raw
+	var ordered bool
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName != "update" {
+				return
+			}
+			ordered = evt.Command.Lookup("ordered").Boolean()
+			values, _ := evt.Command.Lookup("updates").Array().Values()
+			for _, value := range values {
+				updates = append(updates, value.Document())
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("new, existing and invalid", func(mt *mtest.T) {
+		updates = nil
+		newID, existingID := primitive.NewObjectID(), primitive.NewObjectID()
+		mt.AddMockResponses(
+			// Only the second title exists
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: existingID}, {Key: "title", Value: "Walk the dog"}, {Key: "status", Value: StatusTodo}},
+			),
+			// Only the first model is an insert
+			bson.D{
+				{Key: "ok", Value: 1},
+				{Key: "n", Value: 2},
+				{Key: "nModified", Value: 1},
+				{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: newID}}}},
+			},
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: newID}, {Key: "title", Value: "Buy milk"}},
+				bson.D{{Key: "_id", Value: existingID}, {Key: "title", Value: "Walk the dog"}, {Key: "status", Value: StatusDone}},
+			),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		code, results := syncRequest(t, h, `[{"title":"Buy milk"},{"title":"Walk the dog","completed":true},{"title":""}]`)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+		if len(results) != 3 {
+			t.Fatalf("got %d results, want 3", len(results))
+		}
+		if results[0].Result != "created" || results[0].ID != newID.Hex() {
+			t.Errorf("new title: got %+v, want created with id %s", results[0], newID.Hex())
+		}
+		if results[1].Result != "updated" || results[1].ID != existingID.Hex() {
+			t.Errorf("existing title: got %+v, want updated with id %s", results[1], existingID.Hex())
+		}
+		if results[2].Result != "error" || results[2].Code == "" || results[2].ID != "" {
+			t.Errorf("invalid item: got %+v, want an error without an id", results[2])
+		}
+
+		// Both valid items go out in one unordered bulk write: an upsert for
+		// the new title and a guarded update of the todo that was checked
+		if len(updates) != 2 {
+			t.Fatalf("sent %d updates, want 2", len(updates))
+		}
+		if ordered {
+			t.Error("bulk write is ordered")
+		}
+		if upsert, ok := updates[0].Lookup("upsert").BooleanOK(); !ok || !upsert {
+			t.Errorf("new title is not an upsert: %s", updates[0])
+		}
+		if upsert, _ := updates[1].Lookup("upsert").BooleanOK(); upsert {
+			t.Errorf("existing title is an upsert: %s", updates[1])
+		}
+		if id, ok := updates[1].Lookup("q", "_id").ObjectIDOK(); !ok || id != existingID {
+			t.Errorf("existing title update matches %s, want _id %s", updates[1].Lookup("q"), existingID.Hex())
+		}
+		if _, err := updates[1].LookupErr("q", "$expr"); err != nil {
+			t.Errorf("existing title update is not guarded: %s", updates[1].Lookup("q"))
+		}
+	})
+
+	mt.Run("forbidden transition", func(mt *mtest.T) {
+		updates = nil
+		mt.AddMockResponses(
+			// done may only move back to todo
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Buy milk"}, {Key: "status", Value: StatusDone}},
+			),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		code, results := syncRequest(t, h, `[{"title":"Buy milk","status":"blocked"}]`)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+		if len(results) != 1 || results[0].Result != "error" || results[0].Code != CodeInvalidTransition {
+			t.Errorf("got %+v, want INVALID_TRANSITION", results)
+		}
+		if len(updates) != 0 {
+			t.Errorf("sent %d updates, want none", len(updates))
+		}
+	})
+
+	mt.Run("status changed concurrently", func(mt *mtest.T) {
+		updates = nil
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}, {Key: "status", Value: StatusTodo}},
+			),
+			// The todo was completed before the write, so the guard skipped it
+			bson.D{{Key: "ok", Value: 1}, {Key: "n", Value: 0}, {Key: "nModified", Value: 0}},
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}, {Key: "status", Value: StatusDone}},
+			),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		code, results := syncRequest(t, h, `[{"title":"Buy milk","status":"blocked"}]`)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+		if len(results) != 1 || results[0].Result != "error" || results[0].Code != CodeConcurrentModification {
+			t.Errorf("got %+v, want CONCURRENT_MODIFICATION", results)
+		}
+	})
+
+	mt.Run("repeated title", func(mt *mtest.T) {
+		updates = nil
+		h := NewTodoHandler(mt.Coll)
+
+		// Neither item is written, so no mock responses are needed
+		code, results := syncRequest(t, h, `[{"title":"Buy milk"},{"title":"Buy milk"}]`)
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+		for i, result := range results {
+			if result.Result != "error" || result.Code != CodeDuplicateTitle {
+				t.Errorf("item %d: got %+v, want DUPLICATE_TITLE", i, result)
+			}
+		}
+		if len(updates) != 0 {
+			t.Errorf("sent %d updates, want none", len(updates))
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// normalizeTags trims and lowercases tags, dropping empties and duplicates
+// while keeping first-seen order
+func normalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ListTags handles GET /tags. It returns every tag in use, sorted, for
+// building filter menus.
+func (h *TodoHandler) ListTags(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	values, err := h.readCollection.Distinct(ctx, "tags", visible(ctx, bson.M{}))
+	if err != nil {
+		writeDatabaseError(ctx, w, err, "Failed to fetch tags")
+		return
+	}
+
+	tags := make([]string, 0, len(values))
+	for _, value := range values {
+		if tag, ok := value.(string); ok {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+
+	json.NewEncoder(w).Encode(map[string][]string{"tags": tags})
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// titleFilter rejects titles matching a configurable blocklist. A nil filter
+// allows every title.
+type titleFilter struct {
+	patterns []*regexp.Regexp
+}
+
+// loadTitleFilter reads one case-insensitive regular expression per line
+// from path. Blank lines and lines starting with # are ignored. An empty
+// path disables filtering.
+func loadTitleFilter(path string) (*titleFilter, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	filter := &titleFilter{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		pattern, err := regexp.Compile("(?i)" + entry)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		filter.patterns = append(filter.patterns, pattern)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+// allows reports whether title passes the blocklist
+func (f *titleFilter) allows(title string) bool {
+	if f == nil {
+		return true
+	}
+	for _, pattern := range f.patterns {
+		if pattern.MatchString(title) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// writeBlocklist writes a blocklist file and returns its path
+func writeBlocklist(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTitleFilter(t *testing.T) {
+	filter, err := loadTitleFilter("")
+	if err != nil || filter != nil {
+		t.Fatalf("empty path: got %v, %v, want no filter", filter, err)
+	}
+	if !filter.allows("anything") {
+		t.Error("nil filter rejected a title")
+	}
+
+	filter, err = loadTitleFilter(writeBlocklist(t, "# spam\n\nfree money\n^buy now\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filter.patterns) != 2 {
+		t.Errorf("got %d patterns, want comments and blank lines skipped", len(filter.patterns))
+	}
+	for title, want := range map[string]bool{
+		"Get FREE MONEY today": false,
+		"Buy now":              false,
+		"Don't buy now":        true,
+		"Buy milk":             true,
+		"# spam":               true,
+	} {
+		if got := filter.allows(title); got != want {
+			t.Errorf("allows(%q) = %v, want %v", title, got, want)
+		}
+	}
+
+	_, err = loadTitleFilter(writeBlocklist(t, "ok\n(unclosed\n"))
+	if err == nil || !strings.Contains(err.Error(), ":2:") {
+		t.Errorf("bad pattern: err = %v, want it to name line 2", err)
+	}
+	if _, err := loadTitleFilter(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("missing file: want an error")
+	}
+}
+
+func TestTitleRejected(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	// Rejected titles never reach the duplicate check, so no responses are queued
+	mt.Run("create and update", func(mt *mtest.T) {
+		h := NewTodoHandler(mt.Coll)
+		var err error
+		if h.titleFilter, err = loadTitleFilter(writeBlocklist(t, "free money\n")); err != nil {
+			t.Fatal(err)
+		}
+		body := `{"title":"Free money inside"}`
+
+		rec := httptest.NewRecorder()
+		h.CreateTodo(rec, httptest.NewRequest(http.MethodPost, "/api/v1/todos", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeTitleRejected) {
+			t.Errorf("create: got %d %s, want 400 TITLE_REJECTED", rec.Code, rec.Body)
+		}
+
+		r := todoRequest(http.MethodPut, primitive.NewObjectID())
+		r.Body = io.NopCloser(strings.NewReader(body))
+		rec = httptest.NewRecorder()
+		h.UpdateTodo(rec, r)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), CodeTitleRejected) {
+			t.Errorf("update: got %d %s, want 400 TITLE_REJECTED", rec.Code, rec.Body)
+		}
+	})
+}
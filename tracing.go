@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gorilla/mux/otelmux"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracingServiceName identifies the API in traces unless OTEL_SERVICE_NAME
+// overrides it
+const tracingServiceName = "todo-api"
+
+// tracePropagator reads W3C traceparent and baggage headers from incoming
+// requests so their spans join the caller's trace
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// setupTracing returns the tracer provider for the HTTP and MongoDB
+// instrumentation. Spans are exported over OTLP/HTTP when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set;
+// the exporter reads the rest of its settings from the standard OTEL_*
+// variables. Without an endpoint the provider is a no-op. The returned
+// function flushes buffered spans and should be called on shutdown.
+func setupTracing(ctx context.Context) (trace.TracerProvider, func(context.Context) error, error) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES win over the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(tracingServiceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	return provider, provider.Shutdown, nil
+}
+
+// tracingMiddleware starts a server span for every request, named after its
+// route and continuing any trace passed in the request headers
+func tracingMiddleware(provider trace.TracerProvider) mux.MiddlewareFunc {
+	return otelmux.Middleware(tracingServiceName,
+		otelmux.WithTracerProvider(provider),
+		otelmux.WithPropagators(tracePropagator),
+	)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingCreatesSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	// The client is instrumented the same way connectMongoDB does it
+	monitor := otelmongo.NewMonitor(otelmongo.WithTracerProvider(provider))
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("get todo", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+			bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Buy milk"}}))
+		h := NewTodoHandler(mt.Coll)
+
+		r := mux.NewRouter()
+		r.Use(tracingMiddleware(provider))
+		r.HandleFunc("/api/v1/todos/{id}", h.GetTodo).Methods("GET")
+
+		// The caller's trace context arrives in a traceparent header
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/todos/"+id.Hex(), nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", rec.Code)
+		}
+
+		spans := map[string]sdktrace.ReadOnlySpan{}
+		for _, span := range recorder.Ended() {
+			spans[span.Name()] = span
+		}
+
+		server, ok := spans["/api/v1/todos/{id}"]
+		if !ok {
+			t.Fatalf("no span for the route, got %v", spans)
+		}
+		if server.SpanKind() != trace.SpanKindServer {
+			t.Errorf("route span kind = %v, want server", server.SpanKind())
+		}
+		if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf("route span trace = %s, want the caller's trace", got)
+		}
+		if got := server.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+			t.Errorf("route span parent = %s, want the caller's span", got)
+		}
+
+		find, ok := spans[mt.Coll.Name()+".find"]
+		if !ok {
+			t.Fatalf("no span for the find, got %v", spans)
+		}
+		if find.SpanKind() != trace.SpanKindClient {
+			t.Errorf("find span kind = %v, want client", find.SpanKind())
+		}
+	})
+}
+
+func TestSetupTracingWithoutExporter(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+
+	provider, shutdown, err := setupTracing(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	_, span := provider.Tracer("test").Start(context.Background(), "request")
+	if span.IsRecording() {
+		t.Error("span is recorded without an exporter")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errInvalidIfMatch is returned for an If-Match header that is not a version
+var errInvalidIfMatch = errors.New("If-Match must be the todo's ETag")
+
+// versionETag renders a todo version as a strong ETag
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// parseIfMatch reads the version a client expects from If-Match. ok is
+// false when the header is absent.
+func parseIfMatch(r *http.Request) (version int, ok bool, err error) {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		return 0, false, nil
+	}
+
+	version, err = strconv.Atoi(strings.Trim(strings.TrimPrefix(strings.TrimSpace(ifMatch), "W/"), `"`))
+	if err != nil || version < 0 {
+		return 0, false, errInvalidIfMatch
+	}
+	return version, true, nil
+}
+
+// matchVersion narrows an update filter to the expected version. Todos
+// written before versions existed count as version 0.
+func matchVersion(filter bson.M, version int) {
+	if version == 0 {
+		filter["version"] = bson.M{"$in": bson.A{0, nil}}
+		return
+	}
+	filter["version"] = version
+}
+
+// versionIncrement is the pipeline stage that bumps the version
+var versionIncrement = bson.D{{Key: "$set", Value: bson.M{
+	"version": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$version", 0}}, 1}},
+}}}
+
+// writeInvalidIfMatch reports an If-Match header that is not a version ETag
+func writeInvalidIfMatch(w http.ResponseWriter) {
+	writeError(w, http.StatusBadRequest, CodeInvalidIfMatch, errInvalidIfMatch.Error())
+}
+
+// writeMissingOrConflict answers a conditional write that matched nothing:
+// 412 VERSION_CONFLICT when the todo exists at another version, 404 when it
+// does not exist at all
+func (h *TodoHandler) writeMissingOrConflict(ctx context.Context, w http.ResponseWriter, id primitive.ObjectID, conditional bool) {
+	if conditional {
+		count, err := h.collection.CountDocuments(ctx, visible(ctx, bson.M{"_id": id}))
+		if err != nil {
+			writeDatabaseError(ctx, w, err, "Failed to check todo")
+			return
+		}
+		if count > 0 {
+			writeError(w, http.StatusPreconditionFailed, CodeVersionConflict, "Todo has changed since it was last fetched")
+			return
+		}
+	}
+
+	writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Workflow states. StatusDone is kept in sync with the completed flag.
+const (
+	StatusTodo       = "todo"
+	StatusInProgress = "in_progress"
+	StatusDone       = "done"
+	StatusBlocked    = "blocked"
+)
+
+// validStatuses is the allowlist of workflow states
+var validStatuses = map[string]bool{
+	StatusTodo:       true,
+	StatusInProgress: true,
+	StatusDone:       true,
+	StatusBlocked:    true,
+}
+
+// defaultTransitions lists, per state, the states a todo may move to
+var defaultTransitions = map[string][]string{
+	StatusTodo:       {StatusInProgress, StatusBlocked, StatusDone},
+	StatusInProgress: {StatusTodo, StatusBlocked, StatusDone},
+	StatusBlocked:    {StatusTodo, StatusInProgress},
+	StatusDone:       {StatusTodo},
+}
+
+// workflowTransitions holds the active rules, from WORKFLOW_TRANSITIONS when
+// set
+var workflowTransitions = defaultTransitions
+
+// parseTransitions reads rules in the form
+// "todo:in_progress,done;in_progress:todo,done". States without a rule
+// cannot be left.
+func parseTransitions(spec string) (map[string][]string, error) {
+	transitions := map[string][]string{}
+	for _, rule := range strings.Split(spec, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		from, targets, ok := strings.Cut(rule, ":")
+		from = strings.TrimSpace(from)
+		if !ok || !validStatuses[from] {
+			return nil, fmt.Errorf("invalid transition rule %q", rule)
+		}
+		for _, to := range strings.Split(targets, ",") {
+			to = strings.TrimSpace(to)
+			if !validStatuses[to] {
+				return nil, fmt.Errorf("unknown status %q in rule %q", to, rule)
+			}
+			transitions[from] = append(transitions[from], to)
+		}
+	}
+	return transitions, nil
+}
+
+// canTransition reports whether the rules allow moving from one state to
+// another
+func canTransition(from, to string) bool {
+	for _, allowed := range workflowTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// currentStatus returns the todo's workflow state, deriving it from the
+// completed flag for documents written before statuses existed
+func currentStatus(todo Todo) string {
+	if todo.Status != "" {
+		return todo.Status
+	}
+	if todo.Completed {
+		return StatusDone
+	}
+	return StatusTodo
+}
+
+// storedStatus is currentStatus as an aggregation expression
+var storedStatus = bson.M{"$ifNull": bson.A{
+	"$status",
+	bson.M{"$cond": bson.A{"$completed", StatusDone, StatusTodo}},
+}}
+
+// toStatus is the next-state function of a write that sets status outright
+func toStatus(status string) func(from string) string {
+	return func(string) string { return status }
+}
+
+// forCompleted is the next-state function of a write that only sets the
+// completed flag, matching statusForCompleted
+func forCompleted(completed bool) func(from string) string {
+	return func(from string) string {
+		if completed {
+			return StatusDone
+		}
+		if from == StatusDone {
+			return StatusTodo
+		}
+		return from
+	}
+}
+
+// guardTransition narrows an update filter to todos whose current status
+// the rules allow to move to next(status). Staying put is always allowed.
+func guardTransition(filter bson.M, next func(from string) string) {
+	var sources []string
+	for from := range validStatuses {
+		if to := next(from); to == from || canTransition(from, to) {
+			sources = append(sources, from)
+		}
+	}
+	filter["$expr"] = bson.M{"$in": bson.A{storedStatus, sources}}
+}
+
+// writeRejectedUpdate answers a guarded update that matched nothing. The
+// todo is read again to tell why: 404 when it is gone, 412 when If-Match
+// named another version, 409 INVALID_TRANSITION when the rules forbid the
+// status change, and 409 CONCURRENT_MODIFICATION when it changed between
+// the update and the read.
+func (h *TodoHandler) writeRejectedUpdate(ctx context.Context, w http.ResponseWriter, id primitive.ObjectID, expectedVersion int, conditional bool, next func(from string) string) {
+	var todo Todo
+	err := h.collection.FindOne(ctx, visible(ctx, bson.M{"_id": id})).Decode(&todo)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+		} else {
+			writeDatabaseError(ctx, w, err, "Failed to check todo")
+		}
+		return
+	}
+
+	if conditional && todo.Version != expectedVersion {
+		writeError(w, http.StatusPreconditionFailed, CodeVersionConflict, "Todo has changed since it was last fetched")
+		return
+	}
+	from := currentStatus(todo)
+	if to := next(from); to != from && !canTransition(from, to) {
+		writeError(w, http.StatusConflict, CodeInvalidTransition, fmt.Sprintf("Cannot move a todo from %s to %s", from, to))
+		return
+	}
+	writeError(w, http.StatusConflict, CodeConcurrentModification, "Todo was modified concurrently, retry the update")
+}
+
+// syncStatus reconciles status and the deprecated completed flag on an
+// incoming todo. An explicit status wins; otherwise it follows completed.
+func syncStatus(todo *Todo) {
+	if todo.Status == "" {
+		todo.Status = currentStatus(*todo)
+	}
+	todo.Completed = todo.Status == StatusDone
+}
+
+// statusForCompleted is an aggregation expression for the status that goes
+// with a new completed value. Completing moves the workflow to done;
+// reopening a done todo moves it back to todo and leaves other states alone.
+func statusForCompleted(completed bool) bson.M {
+	return bson.M{"$cond": bson.A{
+		completed,
+		StatusDone,
+		bson.M{"$cond": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$status", StatusTodo}}, StatusDone}},
+			StatusTodo,
+			bson.M{"$ifNull": bson.A{"$status", StatusTodo}},
+		}},
+	}}
+}
+
+// loadWorkflowTransitions applies WORKFLOW_TRANSITIONS when it is set
+func loadWorkflowTransitions() error {
+	spec := os.Getenv("WORKFLOW_TRANSITIONS")
+	if spec == "" {
+		return nil
+	}
+
+	transitions, err := parseTransitions(spec)
+	if err != nil {
+		return err
+	}
+	workflowTransitions = transitions
+	return nil
+}
+
+// TransitionTodo handles PATCH /todos/{id}/workflow
+func (h *TodoHandler) TransitionTodo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	ctx, cancel := h.dbContext(r)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	id, err := parseTodoID(vars["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, CodeInvalidID, "Invalid todo ID")
+		return
+	}
+
+	var transition struct {
+		Status string `json:"status"`
+	}
+	if !decodeBody(w, r, &transition) {
+		return
+	}
+
+	if !validStatuses[transition.Status] {
+		writeError(w, http.StatusBadRequest, CodeInvalidStatus, "Status must be one of todo, in_progress, done, blocked")
+		return
+	}
+
+	var todo Todo
+	err = h.collection.FindOne(ctx, visible(ctx, bson.M{"_id": id})).Decode(&todo)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			writeError(w, http.StatusNotFound, CodeNotFound, "Todo not found")
+		} else {
+			writeDatabaseError(ctx, w, err, "Failed to fetch todo")
+		}
+		return
+	}
+
+	from := currentStatus(todo)
+	if from == transition.Status {
+		json.NewEncoder(w).Encode(todo)
+		return
+	}
+	if !canTransition(from, transition.Status) {
+		writeError(w, http.StatusConflict, CodeInvalidTransition, fmt.Sprintf("Cannot move a todo from %s to %s", from, transition.Status))
+		return
+	}
+
+	// Match the version that was read and guard the status in the filter,
+	// so a concurrent change cannot slip past the transition check. Todos
+	// stored before versions and statuses existed match as well.
+	now := time.Now()
+	update := setUpdate(bson.M{
+		"status":     transition.Status,
+		"completed":  transition.Status == StatusDone,
+		"updated_at": now,
+	}, now)
+	filter := visible(ctx, bson.M{"_id": id})
+	matchVersion(filter, todo.Version)
+	next := toStatus(transition.Status)
+	guardTransition(filter, next)
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = h.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&todo)
+	h.invalidate(id)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			h.writeRejectedUpdate(ctx, w, id, 0, false, next)
+		} else {
+			writeDatabaseError(ctx, w, err, "Failed to update todo status")
+		}
+		return
+	}
+
+	json.NewEncoder(w).Encode(todo)
+}
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestParseTransitions(t *testing.T) {
+	got, err := parseTransitions(" todo:in_progress, done ; in_progress:todo;;done:todo ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]string{
+		StatusTodo:       {StatusInProgress, StatusDone},
+		StatusInProgress: {StatusTodo},
+		StatusDone:       {StatusTodo},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, spec := range []string{"todo", "todo:finished", "later:todo", "todo:in_progress;blocked"} {
+		if _, err := parseTransitions(spec); err == nil {
+			t.Errorf("parseTransitions(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{StatusTodo, StatusInProgress, true},
+		{StatusTodo, StatusDone, true},
+		{StatusInProgress, StatusBlocked, true},
+		{StatusBlocked, StatusInProgress, true},
+		{StatusBlocked, StatusDone, false},
+		{StatusDone, StatusTodo, true},
+		{StatusDone, StatusInProgress, false},
+		{StatusTodo, StatusTodo, false},
+	}
+	for _, tt := range tests {
+		if got := canTransition(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransition(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestCanTransitionCustomRules(t *testing.T) {
+	defer func() { workflowTransitions = defaultTransitions }()
+	t.Setenv("WORKFLOW_TRANSITIONS", "todo:done")
+	if err := loadWorkflowTransitions(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !canTransition(StatusTodo, StatusDone) {
+		t.Error("todo -> done should be allowed")
+	}
+	// States without a rule cannot be left
+	if canTransition(StatusDone, StatusTodo) {
+		t.Error("done -> todo should not be allowed")
+	}
+}
+
+func TestCurrentStatusLegacy(t *testing.T) {
+	tests := []struct {
+		todo Todo
+		want string
+	}{
+		{Todo{}, StatusTodo},
+		{Todo{Completed: true}, StatusDone},
+		{Todo{Status: StatusBlocked}, StatusBlocked},
+	}
+	for _, tt := range tests {
+		if got := currentStatus(tt.todo); got != tt.want {
+			t.Errorf("currentStatus(%+v) = %s, want %s", tt.todo, got, tt.want)
+		}
+	}
+}
+
+func TestGuardTransition(t *testing.T) {
+	sources := func(next func(string) string) []string {
+		filter := bson.M{}
+		guardTransition(filter, next)
+		in := filter["$expr"].(bson.M)["$in"].(bson.A)
+		got := append([]string(nil), in[1].([]string)...)
+		sort.Strings(got)
+		return got
+	}
+
+	// Blocked todos cannot be completed, however the write is made
+	want := []string{StatusDone, StatusInProgress, StatusTodo}
+	if got := sources(toStatus(StatusDone)); !reflect.DeepEqual(got, want) {
+		t.Errorf("to done: sources %v, want %v", got, want)
+	}
+	if got := sources(forCompleted(true)); !reflect.DeepEqual(got, want) {
+		t.Errorf("completing: sources %v, want %v", got, want)
+	}
+
+	// Reopening only moves done todos, which may go back to todo
+	want = []string{StatusBlocked, StatusDone, StatusInProgress, StatusTodo}
+	if got := sources(forCompleted(false)); !reflect.DeepEqual(got, want) {
+		t.Errorf("reopening: sources %v, want %v", got, want)
+	}
+}
+
+func TestTodoJSONDerivesLegacyStatus(t *testing.T) {
+	tests := []struct {
+		todo Todo
+		want string
+	}{
+		{Todo{Title: "legacy open"}, StatusTodo},
+		{Todo{Title: "legacy done", Completed: true}, StatusDone},
+		{Todo{Title: "blocked", Status: StatusBlocked}, StatusBlocked},
+	}
+	for _, tt := range tests {
+		for _, v := range []interface{}{tt.todo, newTodoResponse(tt.todo, nil)} {
+			data, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(data), `"status":"`+tt.want+`"`) {
+				t.Errorf("%s: %s, want status %s", tt.todo.Title, data, tt.want)
+			}
+		}
+	}
+}
+
+func TestUpdateTodoStatusAppliesTransitionRules(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("blocked to done", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			// The guarded update matches nothing
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			// and the re-read finds the todo blocked
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Ship it"}, {Key: "status", Value: StatusBlocked}}),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		r := todoRequest(http.MethodPatch, id)
+		r.Body = io.NopCloser(strings.NewReader(`{"completed":true}`))
+		rec := httptest.NewRecorder()
+		h.UpdateTodoStatus(rec, r)
+
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), CodeInvalidTransition) {
+			t.Errorf("got %d %s, want 409 %s", rec.Code, rec.Body, CodeInvalidTransition)
+		}
+	})
+}
+
+func TestTransitionTodoLegacyDocument(t *testing.T) {
+	var updateFilter bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName == "findAndModify" {
+				updateFilter = evt.Command.Lookup("query").Document()
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	transitionRequest := func(id primitive.ObjectID, status string) *http.Request {
+		r := todoRequest(http.MethodPatch, id)
+		r.Body = io.NopCloser(strings.NewReader(`{"status":"` + status + `"}`))
+		return r
+	}
+
+	mt.Run("moved", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		// No status, version or updated_at: stored before any of them existed
+		legacy := bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Ship it"}, {Key: "completed", Value: false}}
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, legacy),
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: append(legacy, bson.E{Key: "status", Value: StatusInProgress}, bson.E{Key: "version", Value: 1})}},
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.TransitionTodo(rec, transitionRequest(id, StatusInProgress))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+		var todo Todo
+		if err := json.Unmarshal(rec.Body.Bytes(), &todo); err != nil {
+			t.Fatal(err)
+		}
+		if todo.Status != StatusInProgress {
+			t.Errorf("status = %q, want %q", todo.Status, StatusInProgress)
+		}
+
+		// The write matches on version and a status guard, not updated_at
+		if _, err := updateFilter.LookupErr("updated_at"); err == nil {
+			t.Errorf("filter %s matches updated_at", updateFilter)
+		}
+		if _, err := updateFilter.LookupErr("version", "$in"); err != nil {
+			t.Errorf("filter %s does not match version 0 or unset", updateFilter)
+		}
+		if _, err := updateFilter.LookupErr("$expr"); err != nil {
+			t.Errorf("filter %s does not guard the transition", updateFilter)
+		}
+	})
+
+	mt.Run("changed to done meanwhile", func(mt *mtest.T) {
+		id := primitive.NewObjectID()
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Ship it"}, {Key: "status", Value: StatusTodo}}),
+			// The guarded update matches nothing
+			bson.D{{Key: "ok", Value: 1}, {Key: "value", Value: nil}},
+			// and the re-read finds the todo done, which cannot be blocked
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: id}, {Key: "title", Value: "Ship it"}, {Key: "status", Value: StatusDone}, {Key: "version", Value: 1}}),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.TransitionTodo(rec, transitionRequest(id, StatusBlocked))
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), CodeInvalidTransition) {
+			t.Errorf("got %d %s, want 409 %s", rec.Code, rec.Body, CodeInvalidTransition)
+		}
+	})
+}
+
+func TestGetTodosStatusFilterDerivesLegacyStatus(t *testing.T) {
+	var findFilter bson.Raw
+	monitor := &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			if evt.CommandName == "find" {
+				findFilter = evt.Command.Lookup("filter").Document()
+			}
+		},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock).ClientOptions(options.Client().SetMonitor(monitor)))
+
+	mt.Run("status=done", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			// The list ETag summary, the count, then the page itself
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, bson.D{{Key: "count", Value: 1}}),
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+			mtest.CreateCursorResponse(0, "todoapp.todos", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Ship it"}, {Key: "completed", Value: true}}),
+		)
+		h := NewTodoHandler(mt.Coll)
+
+		rec := httptest.NewRecorder()
+		h.GetTodos(rec, httptest.NewRequest(http.MethodGet, "/api/v1/todos?status=done", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+		}
+
+		// The raw field is absent on legacy documents, so the filter compares
+		// the derived status instead
+		if _, err := findFilter.LookupErr("status"); err == nil {
+			t.Errorf("filter %s matches the raw status field", findFilter)
+		}
+		if _, err := findFilter.LookupErr("$expr", "$eq"); err != nil {
+			t.Errorf("filter %s does not compare the derived status", findFilter)
+		}
+	})
+}